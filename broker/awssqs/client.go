@@ -0,0 +1,461 @@
+// Package awssqs は broker.Broker の SNS/SQS 実装です
+package awssqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+type (
+	// ProviderOption は Provider 生成時の オプションです
+	ProviderOption struct {
+		AWSAccessKey string
+		AWSSecretKey string
+		AWSRegion    string
+	}
+
+	client struct {
+		opt               *ProviderOption
+		session           *session.Session
+		sns               *sns.SNS
+		sqs               *sqs.SQS
+		topics            *sync.Map
+		topicsGettingLock chan int
+		queues            *sync.Map
+		queuesGettingLock chan int
+	}
+)
+
+// NewClient はインスタンスを生成します
+func NewClient(opt *ProviderOption) (broker.Broker, error) {
+	if err := opt.valid(); err != nil {
+		return nil, err
+	}
+	creds := credentials.NewStaticCredentials(opt.AWSAccessKey, opt.AWSSecretKey, "")
+	session, err := session.NewSession(&aws.Config{
+		Credentials: creds,
+		Region:      &opt.AWSRegion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		opt,
+		session,
+		sns.New(session),
+		sqs.New(session),
+		&sync.Map{},
+		make(chan int, 1),
+		&sync.Map{},
+		make(chan int, 1),
+	}, nil
+}
+
+func (t *ProviderOption) valid() error {
+	slice := make([]string, 0)
+	if t.AWSAccessKey == "" {
+		slice = append(slice, "AWSAccessKey is required.")
+	}
+	if t.AWSSecretKey == "" {
+		slice = append(slice, "AWSSecretKey is required.")
+	}
+	if t.AWSRegion == "" {
+		slice = append(slice, "AWSRegion is required.")
+	}
+	if len(slice) > 0 {
+		return errors.New(strings.Join(slice, "\n"))
+	}
+	return nil
+}
+
+func (t *client) GetTopicID(ctx context.Context, name string, config *broker.TopicConfigAttributes) (string, error) {
+	if value, ok := t.topics.Load(name); ok {
+		return value.(string), nil
+	}
+	t.topicsGettingLock <- 1
+	defer func() { <-t.topicsGettingLock }()
+	if value, ok := t.topics.Load(name); ok {
+		return value.(string), nil
+	}
+
+	var nextToken *string = nil
+	first := true
+	for nextToken != nil || first {
+		resp, err := t.sns.ListTopicsWithContext(ctx, &sns.ListTopicsInput{NextToken: nextToken})
+		if err != nil {
+			return "", err
+		}
+		for _, topic := range resp.Topics {
+			arn := *topic.TopicArn
+			slice := strings.Split(arn, ":")
+			name := slice[len(slice)-1]
+			t.topics.Store(name, arn)
+		}
+		first = false
+		nextToken = resp.NextToken
+	}
+
+	if value, ok := t.topics.Load(name); ok {
+		return value.(string), nil
+	}
+	if config == nil {
+		return "", fmt.Errorf("There is no topic named %s", name)
+	}
+
+	arn, err := t.createTopic(ctx, name, config)
+	if err != nil {
+		return "", err
+	}
+	t.topics.Store(name, arn)
+	return arn, nil
+}
+
+func (t *client) createTopic(ctx context.Context, name string, config *broker.TopicConfigAttributes) (string, error) {
+	attributes := map[string]*string{}
+	if config.KmsMasterKeyID != nil {
+		attributes["KmsMasterKeyId"] = config.KmsMasterKeyID
+	}
+	if config.Fifo {
+		attributes["FifoTopic"] = aws.String("true")
+	}
+	resp, err := t.sns.CreateTopicWithContext(ctx, &sns.CreateTopicInput{Name: &name, Attributes: attributes})
+	if err != nil {
+		return "", err
+	}
+	return *resp.TopicArn, nil
+}
+
+func (t *client) GetQueueID(ctx context.Context, name string, config *broker.QueueConfigAttributes) (string, error) {
+	if value, ok := t.queues.Load(name); ok {
+		return value.(string), nil
+	}
+	t.queuesGettingLock <- 1
+	defer func() { <-t.queuesGettingLock }()
+	if value, ok := t.queues.Load(name); ok {
+		return value.(string), nil
+	}
+
+	resp, err := t.sqs.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{QueueName: &name})
+	if err != nil {
+		if config == nil || !isQueueNotFound(err) {
+			return "", err
+		}
+		queueURL, createErr := t.createQueue(ctx, name, config)
+		if createErr != nil {
+			return "", createErr
+		}
+		t.queues.Store(name, queueURL)
+		return queueURL, nil
+	}
+
+	if config != nil {
+		if err := t.reconcileQueueAttributes(ctx, *resp.QueueUrl, config); err != nil {
+			return "", err
+		}
+	}
+	t.queues.Store(name, *resp.QueueUrl)
+
+	if value, ok := t.queues.Load(name); ok {
+		return value.(string), nil
+	}
+	return "", fmt.Errorf("There is no queue named %s", name)
+}
+
+func isQueueNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == sqs.ErrCodeQueueDoesNotExist
+}
+
+func (t *client) createQueue(ctx context.Context, name string, config *broker.QueueConfigAttributes) (string, error) {
+	resp, err := t.sqs.CreateQueueWithContext(ctx, &sqs.CreateQueueInput{
+		QueueName:  &name,
+		Attributes: toQueueAttributes(config),
+	})
+	if err != nil {
+		return "", err
+	}
+	return *resp.QueueUrl, nil
+}
+
+func (t *client) reconcileQueueAttributes(ctx context.Context, queueURL string, config *broker.QueueConfigAttributes) error {
+	_, err := t.sqs.SetQueueAttributesWithContext(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   &queueURL,
+		Attributes: toQueueAttributes(config),
+	})
+	return err
+}
+
+func toQueueAttributes(config *broker.QueueConfigAttributes) map[string]*string {
+	attributes := map[string]*string{}
+	if config.VisibilityTimeout != nil {
+		attributes[sqs.QueueAttributeNameVisibilityTimeout] = aws.String(strconv.FormatInt(*config.VisibilityTimeout, 10))
+	}
+	if config.MessageRetentionPeriod != nil {
+		attributes[sqs.QueueAttributeNameMessageRetentionPeriod] = aws.String(strconv.FormatInt(*config.MessageRetentionPeriod, 10))
+	}
+	if config.KmsMasterKeyID != nil {
+		attributes[sqs.QueueAttributeNameKmsMasterKeyId] = config.KmsMasterKeyID
+	}
+	if config.Fifo {
+		attributes[sqs.QueueAttributeNameFifoQueue] = aws.String("true")
+	}
+	if config.RedrivePolicy != nil {
+		attributes[sqs.QueueAttributeNameRedrivePolicy] = config.RedrivePolicy
+	}
+	return attributes
+}
+
+func (t *client) Publish(ctx context.Context, args *broker.PublishArgs) error {
+	input := &sns.PublishInput{
+		TopicArn:          &args.TopicID,
+		Subject:           &args.Subject,
+		Message:           &args.Message,
+		MessageAttributes: toSNSMessageAttributes(args.MessageAttributes),
+	}
+	if args.MessageGroupID != "" {
+		input.MessageGroupId = &args.MessageGroupID
+	}
+	if args.MessageDeduplicationID != "" {
+		input.MessageDeduplicationId = &args.MessageDeduplicationID
+	}
+	_, err := t.sns.PublishWithContext(ctx, input)
+	return err
+}
+
+func (t *client) SendMessage(ctx context.Context, args *broker.SendMessageArgs) error {
+	input := &sqs.SendMessageInput{
+		QueueUrl:          &args.QueueID,
+		MessageBody:       &args.Message,
+		MessageAttributes: toSQSMessageAttributes(args.MessageAttributes),
+	}
+	if args.MessageGroupID != "" {
+		input.MessageGroupId = &args.MessageGroupID
+	}
+	if args.MessageDeduplicationID != "" {
+		input.MessageDeduplicationId = &args.MessageDeduplicationID
+	}
+	_, err := t.sqs.SendMessageWithContext(ctx, input)
+	return err
+}
+
+func (t *client) PublishBatch(ctx context.Context, args *broker.PublishBatchArgs) (*broker.BatchResult, error) {
+	entries := make([]*sns.PublishBatchRequestEntry, len(args.Entries))
+	for i, entry := range args.Entries {
+		entries[i] = &sns.PublishBatchRequestEntry{
+			Id:                &entry.ID,
+			Subject:           &entry.Subject,
+			Message:           &entry.Message,
+			MessageAttributes: toSNSMessageAttributes(entry.MessageAttributes),
+		}
+	}
+
+	res, err := t.sns.PublishBatchWithContext(ctx, &sns.PublishBatchInput{
+		TopicArn:                   &args.TopicID,
+		PublishBatchRequestEntries: entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &broker.BatchResult{Failed: fromSNSBatchResultErrorEntries(res.Failed)}, nil
+}
+
+func (t *client) SendMessageBatch(ctx context.Context, args *broker.SendMessageBatchArgs) (*broker.BatchResult, error) {
+	entries := make([]*sqs.SendMessageBatchRequestEntry, len(args.Entries))
+	for i, entry := range args.Entries {
+		entries[i] = &sqs.SendMessageBatchRequestEntry{
+			Id:                &entry.ID,
+			MessageBody:       &entry.Message,
+			MessageAttributes: toSQSMessageAttributes(entry.MessageAttributes),
+		}
+	}
+
+	res, err := t.sqs.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: &args.QueueID,
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &broker.BatchResult{Failed: fromSQSBatchResultErrorEntries(res.Failed)}, nil
+}
+
+func toSNSMessageAttributes(attributes map[string]string) map[string]*sns.MessageAttributeValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	result := make(map[string]*sns.MessageAttributeValue, len(attributes))
+	for key, value := range attributes {
+		result[key] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return result
+}
+
+func toSQSMessageAttributes(attributes map[string]string) map[string]*sqs.MessageAttributeValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	result := make(map[string]*sqs.MessageAttributeValue, len(attributes))
+	for key, value := range attributes {
+		result[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return result
+}
+
+func fromSQSMessageAttributes(attributes map[string]*sqs.MessageAttributeValue) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		if value.StringValue != nil {
+			result[key] = *value.StringValue
+		}
+	}
+	return result
+}
+
+func fromSNSBatchResultErrorEntries(failed []*sns.BatchResultErrorEntry) []broker.BatchEntryError {
+	if len(failed) == 0 {
+		return nil
+	}
+	result := make([]broker.BatchEntryError, len(failed))
+	for i, entry := range failed {
+		result[i] = broker.BatchEntryError{ID: *entry.Id, Code: *entry.Code, Message: *entry.Message}
+	}
+	return result
+}
+
+func fromSQSBatchResultErrorEntries(failed []*sqs.BatchResultErrorEntry) []broker.BatchEntryError {
+	if len(failed) == 0 {
+		return nil
+	}
+	result := make([]broker.BatchEntryError, len(failed))
+	for i, entry := range failed {
+		result[i] = broker.BatchEntryError{ID: *entry.Id, Code: *entry.Code, Message: *entry.Message}
+	}
+	return result
+}
+
+func fromSQSAttributes(attributes map[string]*string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		if value != nil {
+			result[key] = *value
+		}
+	}
+	return result
+}
+
+func (t *client) ReceiveMessages(ctx context.Context, args *broker.ReceiveMessagesArgs) (*broker.ReceiveMessagesResult, error) {
+	res, err := t.sqs.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl: &args.QueueID,
+		// 一度に取得する最大メッセージ数。最大でも10まで。
+		MaxNumberOfMessages: aws.Int64(10),
+		// これでキューが空の場合はロングポーリング(20秒間繋ぎっぱなし)になる。
+		WaitTimeSeconds:       aws.Int64(20),
+		MessageAttributeNames: []*string{aws.String("All")},
+		AttributeNames:        aws.StringSlice(args.AttributeNames),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &broker.ReceiveMessagesResult{
+		ReceiveMessages: make([]*broker.ReceiveMessage, len(res.Messages)),
+	}
+	for i, msg := range res.Messages {
+		result.ReceiveMessages[i] = &broker.ReceiveMessage{
+			Body:              msg.Body,
+			MessageID:         *msg.MessageId,
+			ReceiptHandle:     *msg.ReceiptHandle,
+			MessageAttributes: fromSQSMessageAttributes(msg.MessageAttributes),
+			Attributes:        fromSQSAttributes(msg.Attributes),
+		}
+	}
+	return result, err
+}
+
+func (t *client) ReportFailureMessage(ctx context.Context, args *broker.ReportFailureMessageArgs) error {
+	_, err := t.sqs.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &args.QueueID,
+		ReceiptHandle:     &args.ReceiptHandle,
+		VisibilityTimeout: &args.WaitTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *client) ReportSuccessMessage(ctx context.Context, args *broker.ReportSuccessMessageArgs) error {
+	_, err := t.sqs.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &args.QueueID,
+		ReceiptHandle: &args.ReceiptHandle,
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *client) ReportSuccessMessages(ctx context.Context, args *broker.ReportSuccessMessagesArgs) (*broker.BatchResult, error) {
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(args.Entries))
+	for i, entry := range args.Entries {
+		entries[i] = &sqs.DeleteMessageBatchRequestEntry{
+			Id:            &entry.ID,
+			ReceiptHandle: &entry.ReceiptHandle,
+		}
+	}
+
+	res, err := t.sqs.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: &args.QueueID,
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &broker.BatchResult{Failed: fromSQSBatchResultErrorEntries(res.Failed)}, nil
+}
+
+func (t *client) ReportFailureMessages(ctx context.Context, args *broker.ReportFailureMessagesArgs) (*broker.BatchResult, error) {
+	entries := make([]*sqs.ChangeMessageVisibilityBatchRequestEntry, len(args.Entries))
+	for i, entry := range args.Entries {
+		entries[i] = &sqs.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                &entry.ID,
+			ReceiptHandle:     &entry.ReceiptHandle,
+			VisibilityTimeout: &entry.WaitTime,
+		}
+	}
+
+	res, err := t.sqs.ChangeMessageVisibilityBatchWithContext(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: &args.QueueID,
+		Entries:  entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &broker.BatchResult{Failed: fromSQSBatchResultErrorEntries(res.Failed)}, nil
+}
@@ -0,0 +1,143 @@
+// Package broker は pub/sub のメッセージブローカーに対する抽象です。
+// 実装は broker/awssqs (SNS/SQS)、broker/memory (インメモリ)、broker/natsjs (NATS JetStream) などの
+// サブパッケージに置き、pub.NewPublisher / sub.NewSubscriber はこの Broker だけに依存します。
+package broker
+
+import "context"
+
+// MaxBatchSize は PublishBatch などのバッチ系 API が 1 リクエストで受け付けるエントリ数の上限です。
+// SNS/SQS の制約に由来しますが、pub/sub 側のチャンク分割・バッファリングもこの値を単位に行うため、
+// 実装によらない共通の定数としてここに置いています
+const MaxBatchSize = 10
+
+type (
+	// Broker は メッセージブローカーへのアクセサです
+	Broker interface {
+		// GetTopicID はトピック名から実装固有の識別子(ARN など)を引きます。config が指定されていて
+		// トピックが存在しない場合は自動作成します
+		GetTopicID(ctx context.Context, name string, config *TopicConfigAttributes) (string, error)
+		// GetQueueID はキュー名から実装固有の識別子(URL など)を引きます。config が指定されていて
+		// キューが存在しない場合は自動作成し、存在する場合も属性が乖離していれば是正します
+		GetQueueID(ctx context.Context, name string, config *QueueConfigAttributes) (string, error)
+		Publish(ctx context.Context, args *PublishArgs) error
+		SendMessage(ctx context.Context, args *SendMessageArgs) error
+		PublishBatch(ctx context.Context, args *PublishBatchArgs) (*BatchResult, error)
+		SendMessageBatch(ctx context.Context, args *SendMessageBatchArgs) (*BatchResult, error)
+		ReceiveMessages(ctx context.Context, args *ReceiveMessagesArgs) (*ReceiveMessagesResult, error)
+		ReportFailureMessage(ctx context.Context, args *ReportFailureMessageArgs) error
+		ReportSuccessMessage(ctx context.Context, args *ReportSuccessMessageArgs) error
+		ReportFailureMessages(ctx context.Context, args *ReportFailureMessagesArgs) (*BatchResult, error)
+		ReportSuccessMessages(ctx context.Context, args *ReportSuccessMessagesArgs) (*BatchResult, error)
+	}
+	// PublishArgs は Publish の引数です
+	PublishArgs struct {
+		TopicID           string
+		Subject           string
+		Message           string
+		MessageAttributes map[string]string
+		// MessageGroupID と MessageDeduplicationID は FIFO トピック向けの指定です。通常のトピックでは空のままにします
+		MessageGroupID         string
+		MessageDeduplicationID string
+	}
+	// SendMessageArgs は SendMessage の引数です
+	SendMessageArgs struct {
+		QueueID           string
+		Message           string
+		MessageAttributes map[string]string
+		// MessageGroupID と MessageDeduplicationID は FIFO キュー向けの指定です。通常のキューでは空のままにします
+		MessageGroupID         string
+		MessageDeduplicationID string
+	}
+	// QueueConfigAttributes は GetQueueID がキューを自動作成・是正する際に使用する属性です
+	QueueConfigAttributes struct {
+		VisibilityTimeout      *int64
+		MessageRetentionPeriod *int64
+		KmsMasterKeyID         *string
+		Fifo                   bool
+		RedrivePolicy          *string
+	}
+	// TopicConfigAttributes は GetTopicID がトピックを自動作成する際に使用する属性です
+	TopicConfigAttributes struct {
+		KmsMasterKeyID *string
+		Fifo           bool
+	}
+	// ReceiveMessagesArgs は ReceiveMessages の引数です
+	ReceiveMessagesArgs struct {
+		QueueID string
+		// AttributeNames は ApproximateReceiveCount などのシステム属性のうち取得したいものです
+		AttributeNames []string
+	}
+	// ReceiveMessagesResult は ReceiveMessages の戻り値です
+	ReceiveMessagesResult struct {
+		ReceiveMessages []*ReceiveMessage
+	}
+	// ReceiveMessage です
+	ReceiveMessage struct {
+		MessageID         string
+		ReceiptHandle     string
+		Body              *string
+		MessageAttributes map[string]string
+		// Attributes は ApproximateReceiveCount などのシステム属性です
+		Attributes map[string]string
+	}
+	// ReportFailureMessageArgs は ReportFailureMessage の引数です
+	ReportFailureMessageArgs struct {
+		QueueID       string
+		ReceiptHandle string
+		WaitTime      int64
+	}
+	// ReportSuccessMessageArgs は ReportSuccessMessage の引数です
+	ReportSuccessMessageArgs struct {
+		QueueID       string
+		ReceiptHandle string
+	}
+	// BatchEntry は Publish/SendMessage のバッチ送信 1 件分の引数です。ID は呼び出し元がエントリと
+	// BatchResult.Failed を突き合わせるために付与する一意な文字列です(MaxBatchSize 件までの制約があるため連番で十分です)
+	BatchEntry struct {
+		ID                string
+		Message           string
+		Subject           string
+		MessageAttributes map[string]string
+	}
+	// BatchResult は バッチ操作のうち失敗したエントリの一覧です。Failed に含まれない ID は成功しています
+	BatchResult struct {
+		Failed []BatchEntryError
+	}
+	// BatchEntryError は バッチ操作で失敗した 1 件分のエラーです
+	BatchEntryError struct {
+		ID      string
+		Code    string
+		Message string
+	}
+	// PublishBatchArgs は PublishBatch の引数です。Entries は MaxBatchSize 件までです
+	PublishBatchArgs struct {
+		TopicID string
+		Entries []BatchEntry
+	}
+	// SendMessageBatchArgs は SendMessageBatch の引数です。Entries は MaxBatchSize 件までです
+	SendMessageBatchArgs struct {
+		QueueID string
+		Entries []BatchEntry
+	}
+	// ReportSuccessMessagesArgs は ReportSuccessMessages の引数です。Entries は MaxBatchSize 件までです
+	ReportSuccessMessagesArgs struct {
+		QueueID string
+		Entries []BatchReceiptHandle
+	}
+	// ReportFailureMessagesArgs は ReportFailureMessages の引数です。Entries は MaxBatchSize 件までです
+	ReportFailureMessagesArgs struct {
+		QueueID string
+		Entries []BatchVisibilityEntry
+	}
+	// BatchReceiptHandle は ReportSuccessMessages の 1 件分の引数です
+	BatchReceiptHandle struct {
+		ID            string
+		ReceiptHandle string
+	}
+	// BatchVisibilityEntry は ReportFailureMessages の 1 件分の引数です
+	BatchVisibilityEntry struct {
+		ID            string
+		ReceiptHandle string
+		WaitTime      int64
+	}
+)
@@ -0,0 +1,342 @@
+// Package memory は broker.Broker のインメモリ実装です。LocalStack などの実 AWS 環境を用意しなくても
+// sub.Subscriber の状態遷移(再試行・セマフォ・ack/nack)をテストできるようにするためのものです
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// defaultVisibilityTimeout は QueueConfigAttributes.VisibilityTimeout が未設定のキューで使われる既定値です
+const defaultVisibilityTimeout = 30 * time.Second
+
+type (
+	// Broker は broker.Broker のインメモリ実装です。実体を直接参照することで Subscribe による
+	// トピック-キュー間のファンアウト設定など、テスト用の追加操作が行えます
+	Broker struct {
+		mu            sync.Mutex
+		topics        map[string]struct{}
+		queues        map[string]*queue
+		subscriptions map[string][]string
+	}
+	queue struct {
+		mu                sync.Mutex
+		visibilityTimeout time.Duration
+		pending           []*message
+		inFlight          map[string]*inFlightMessage
+	}
+	message struct {
+		id                string
+		body              string
+		messageAttributes map[string]string
+		attributes        map[string]string
+	}
+	inFlightMessage struct {
+		message *message
+		timer   *time.Timer
+	}
+)
+
+// NewBroker はインスタンスを生成します
+func NewBroker() *Broker {
+	return &Broker{
+		topics:        make(map[string]struct{}),
+		queues:        make(map[string]*queue),
+		subscriptions: make(map[string][]string),
+	}
+}
+
+// Subscribe は topicName への Publish を queueName へ配送するよう登録します。
+// 実 AWS における SNS トピックと SQS キューのサブスクリプションに相当し、事前に両方が
+// 存在している(あるいは GetTopicID/GetQueueID の config 付き呼び出しで作成済みである)必要があります
+func (t *Broker) Subscribe(topicName, queueName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.topics[topicName]; !ok {
+		return fmt.Errorf("There is no topic named %s", topicName)
+	}
+	if _, ok := t.queues[queueName]; !ok {
+		return fmt.Errorf("There is no queue named %s", queueName)
+	}
+	t.subscriptions[topicName] = append(t.subscriptions[topicName], queueName)
+	return nil
+}
+
+func (t *Broker) GetTopicID(ctx context.Context, name string, config *broker.TopicConfigAttributes) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.topics[name]; ok {
+		return name, nil
+	}
+	if config == nil {
+		return "", fmt.Errorf("There is no topic named %s", name)
+	}
+	t.topics[name] = struct{}{}
+	return name, nil
+}
+
+func (t *Broker) GetQueueID(ctx context.Context, name string, config *broker.QueueConfigAttributes) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queues[name]; ok {
+		if config != nil {
+			q.mu.Lock()
+			q.visibilityTimeout = visibilityTimeoutOf(config)
+			q.mu.Unlock()
+		}
+		return name, nil
+	}
+	if config == nil {
+		return "", fmt.Errorf("There is no queue named %s", name)
+	}
+	t.queues[name] = newQueue(visibilityTimeoutOf(config))
+	return name, nil
+}
+
+func visibilityTimeoutOf(config *broker.QueueConfigAttributes) time.Duration {
+	if config.VisibilityTimeout == nil {
+		return defaultVisibilityTimeout
+	}
+	return time.Duration(*config.VisibilityTimeout) * time.Second
+}
+
+func newQueue(visibilityTimeout time.Duration) *queue {
+	return &queue{
+		visibilityTimeout: visibilityTimeout,
+		inFlight:          make(map[string]*inFlightMessage),
+	}
+}
+
+func (t *Broker) Publish(ctx context.Context, args *broker.PublishArgs) error {
+	t.mu.Lock()
+	queueNames := append([]string(nil), t.subscriptions[args.TopicID]...)
+	t.mu.Unlock()
+
+	for _, queueName := range queueNames {
+		if err := t.enqueue(queueName, &message{
+			id:                uuid.NewString(),
+			body:              args.Message,
+			messageAttributes: args.MessageAttributes,
+			attributes:        map[string]string{"Subject": args.Subject},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Broker) SendMessage(ctx context.Context, args *broker.SendMessageArgs) error {
+	return t.enqueue(args.QueueID, &message{
+		id:                uuid.NewString(),
+		body:              args.Message,
+		messageAttributes: args.MessageAttributes,
+		attributes:        map[string]string{},
+	})
+}
+
+func (t *Broker) enqueue(queueName string, msg *message) error {
+	t.mu.Lock()
+	q, ok := t.queues[queueName]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("There is no queue named %s", queueName)
+	}
+	q.mu.Lock()
+	q.pending = append(q.pending, msg)
+	q.mu.Unlock()
+	return nil
+}
+
+func (t *Broker) PublishBatch(ctx context.Context, args *broker.PublishBatchArgs) (*broker.BatchResult, error) {
+	result := &broker.BatchResult{}
+	for _, entry := range args.Entries {
+		if err := t.Publish(ctx, &broker.PublishArgs{
+			TopicID:           args.TopicID,
+			Subject:           entry.Subject,
+			Message:           entry.Message,
+			MessageAttributes: entry.MessageAttributes,
+		}); err != nil {
+			result.Failed = append(result.Failed, broker.BatchEntryError{ID: entry.ID, Code: "Internal", Message: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+func (t *Broker) SendMessageBatch(ctx context.Context, args *broker.SendMessageBatchArgs) (*broker.BatchResult, error) {
+	result := &broker.BatchResult{}
+	for _, entry := range args.Entries {
+		if err := t.SendMessage(ctx, &broker.SendMessageArgs{
+			QueueID:           args.QueueID,
+			Message:           entry.Message,
+			MessageAttributes: entry.MessageAttributes,
+		}); err != nil {
+			result.Failed = append(result.Failed, broker.BatchEntryError{ID: entry.ID, Code: "Internal", Message: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+func (t *Broker) ReceiveMessages(ctx context.Context, args *broker.ReceiveMessagesArgs) (*broker.ReceiveMessagesResult, error) {
+	t.mu.Lock()
+	q, ok := t.queues[args.QueueID]
+	t.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("There is no queue named %s", args.QueueID)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	take := len(q.pending)
+	if take > broker.MaxBatchSize {
+		take = broker.MaxBatchSize
+	}
+	msgs := q.pending[:take]
+	q.pending = q.pending[take:]
+
+	result := &broker.ReceiveMessagesResult{ReceiveMessages: make([]*broker.ReceiveMessage, take)}
+	for i, msg := range msgs {
+		receiptHandle := uuid.NewString()
+		attributes := withReceiveCount(msg.attributes, receiptCountOf(msg.attributes)+1)
+		msg.attributes = attributes
+
+		result.ReceiveMessages[i] = &broker.ReceiveMessage{
+			MessageID:         msg.id,
+			ReceiptHandle:     receiptHandle,
+			Body:              &msg.body,
+			MessageAttributes: msg.messageAttributes,
+			Attributes:        filterRequestedAttributes(attributes, args.AttributeNames),
+		}
+		q.inFlight[receiptHandle] = &inFlightMessage{
+			message: msg,
+			timer:   time.AfterFunc(q.visibilityTimeout, t.makeVisible(args.QueueID, receiptHandle)),
+		}
+	}
+	return result, nil
+}
+
+func (t *Broker) makeVisible(queueName, receiptHandle string) func() {
+	return func() {
+		t.mu.Lock()
+		q, ok := t.queues[queueName]
+		t.mu.Unlock()
+		if !ok {
+			return
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		inFlight, ok := q.inFlight[receiptHandle]
+		if !ok {
+			return
+		}
+		delete(q.inFlight, receiptHandle)
+		q.pending = append(q.pending, inFlight.message)
+	}
+}
+
+func receiptCountOf(attributes map[string]string) int64 {
+	count, _ := strconv.ParseInt(attributes["ApproximateReceiveCount"], 10, 64)
+	return count
+}
+
+func withReceiveCount(attributes map[string]string, count int64) map[string]string {
+	result := make(map[string]string, len(attributes)+1)
+	for key, value := range attributes {
+		result[key] = value
+	}
+	result["ApproximateReceiveCount"] = strconv.FormatInt(count, 10)
+	return result
+}
+
+func filterRequestedAttributes(attributes map[string]string, names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, ok := attributes[name]; ok {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+func (t *Broker) ReportFailureMessage(ctx context.Context, args *broker.ReportFailureMessageArgs) error {
+	return t.releaseInFlight(args.QueueID, args.ReceiptHandle, time.Duration(args.WaitTime)*time.Second)
+}
+
+func (t *Broker) ReportSuccessMessage(ctx context.Context, args *broker.ReportSuccessMessageArgs) error {
+	return t.ackInFlight(args.QueueID, args.ReceiptHandle)
+}
+
+func (t *Broker) ReportFailureMessages(ctx context.Context, args *broker.ReportFailureMessagesArgs) (*broker.BatchResult, error) {
+	result := &broker.BatchResult{}
+	for _, entry := range args.Entries {
+		if err := t.releaseInFlight(args.QueueID, entry.ReceiptHandle, time.Duration(entry.WaitTime)*time.Second); err != nil {
+			result.Failed = append(result.Failed, broker.BatchEntryError{ID: entry.ID, Code: "Internal", Message: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+func (t *Broker) ReportSuccessMessages(ctx context.Context, args *broker.ReportSuccessMessagesArgs) (*broker.BatchResult, error) {
+	result := &broker.BatchResult{}
+	for _, entry := range args.Entries {
+		if err := t.ackInFlight(args.QueueID, entry.ReceiptHandle); err != nil {
+			result.Failed = append(result.Failed, broker.BatchEntryError{ID: entry.ID, Code: "Internal", Message: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+func (t *Broker) ackInFlight(queueName, receiptHandle string) error {
+	t.mu.Lock()
+	q, ok := t.queues[queueName]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("There is no queue named %s", queueName)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	inFlight, ok := q.inFlight[receiptHandle]
+	if !ok {
+		return fmt.Errorf("There is no in-flight message for receipt handle %s", receiptHandle)
+	}
+	inFlight.timer.Stop()
+	delete(q.inFlight, receiptHandle)
+	return nil
+}
+
+func (t *Broker) releaseInFlight(queueName, receiptHandle string, waitTime time.Duration) error {
+	t.mu.Lock()
+	q, ok := t.queues[queueName]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("There is no queue named %s", queueName)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	inFlight, ok := q.inFlight[receiptHandle]
+	if !ok {
+		return fmt.Errorf("There is no in-flight message for receipt handle %s", receiptHandle)
+	}
+	inFlight.timer.Stop()
+
+	if waitTime <= 0 {
+		delete(q.inFlight, receiptHandle)
+		q.pending = append(q.pending, inFlight.message)
+		return nil
+	}
+	inFlight.timer = time.AfterFunc(waitTime, t.makeVisible(queueName, receiptHandle))
+	return nil
+}
+
+var _ broker.Broker = (*Broker)(nil)
@@ -0,0 +1,77 @@
+// Package natsjs は NATS JetStream 向けの broker.Broker 実装の雛形です。
+// broker.Broker は SNS/SQS (broker/awssqs) やインメモリ (broker/memory) に限らず、トピック/キューの
+// 概念を持つ任意のメッセージング基盤に実装を追加できる拡張点であることを示すためのスタブで、
+// 実際の配送ロジックは未実装です。実装する際は nats.io/nats.go の JetStream API を使い、
+// GetTopicID/GetQueueID をストリーム・コンシューマの作成に、Publish/SendMessage を js.Publish に、
+// ReceiveMessages/ReportSuccessMessage/ReportFailureMessage を Pull Consumer の Fetch/Ack/Nak にマッピングする
+package natsjs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// ErrNotImplemented は このスタブがまだ配送ロジックを持たないことを表します
+var ErrNotImplemented = errors.New("natsjs: not implemented")
+
+type (
+	// ProviderOption は Provider 生成時の オプションです
+	ProviderOption struct {
+		URL string
+	}
+
+	client struct {
+		opt *ProviderOption
+	}
+)
+
+// NewClient はインスタンスを生成します。接続確立と JetStream コンテキストの取得は実装時に追加します
+func NewClient(opt *ProviderOption) (broker.Broker, error) {
+	return &client{opt}, nil
+}
+
+func (t *client) GetTopicID(ctx context.Context, name string, config *broker.TopicConfigAttributes) (string, error) {
+	return "", ErrNotImplemented
+}
+
+func (t *client) GetQueueID(ctx context.Context, name string, config *broker.QueueConfigAttributes) (string, error) {
+	return "", ErrNotImplemented
+}
+
+func (t *client) Publish(ctx context.Context, args *broker.PublishArgs) error {
+	return ErrNotImplemented
+}
+
+func (t *client) SendMessage(ctx context.Context, args *broker.SendMessageArgs) error {
+	return ErrNotImplemented
+}
+
+func (t *client) PublishBatch(ctx context.Context, args *broker.PublishBatchArgs) (*broker.BatchResult, error) {
+	return nil, ErrNotImplemented
+}
+
+func (t *client) SendMessageBatch(ctx context.Context, args *broker.SendMessageBatchArgs) (*broker.BatchResult, error) {
+	return nil, ErrNotImplemented
+}
+
+func (t *client) ReceiveMessages(ctx context.Context, args *broker.ReceiveMessagesArgs) (*broker.ReceiveMessagesResult, error) {
+	return nil, ErrNotImplemented
+}
+
+func (t *client) ReportFailureMessage(ctx context.Context, args *broker.ReportFailureMessageArgs) error {
+	return ErrNotImplemented
+}
+
+func (t *client) ReportSuccessMessage(ctx context.Context, args *broker.ReportSuccessMessageArgs) error {
+	return ErrNotImplemented
+}
+
+func (t *client) ReportFailureMessages(ctx context.Context, args *broker.ReportFailureMessagesArgs) (*broker.BatchResult, error) {
+	return nil, ErrNotImplemented
+}
+
+func (t *client) ReportSuccessMessages(ctx context.Context, args *broker.ReportSuccessMessagesArgs) (*broker.BatchResult, error) {
+	return nil, ErrNotImplemented
+}
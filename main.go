@@ -1,18 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
 	"os"
+	"os/signal"
 	"sync"
 
-	"github.com/wakuwaku3/example-pubsub.go/aws"
+	"github.com/wakuwaku3/example-pubsub.go/broker/awssqs"
 	"github.com/wakuwaku3/example-pubsub.go/pub"
 	"github.com/wakuwaku3/example-pubsub.go/sub"
 )
 
 func main() {
-	client, err := aws.NewClient(&aws.ProviderOption{
+	client, err := awssqs.NewClient(&awssqs.ProviderOption{
 		AWSAccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
 		AWSSecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
 		AWSRegion:    os.Getenv("AWS_DEFAULT_REGION"),
@@ -23,23 +25,37 @@ func main() {
 	}
 	awsPrefix := os.Getenv("AWS_PREFIX")
 
-	subscriber := sub.NewSubscriber(client)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	subscriber, err := sub.NewSubscriber(client, &sub.SubscriberOption{ConcurrencyMessageHandleLimit: 10})
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
 	subscriber.SetHandler(awsPrefix+"Queue1", handleQueue1, &sub.HandlerOption{WaitTime: 0})
-	subscriber.SetHandler(awsPrefix+"Queue2", handleQueue2, &sub.HandlerOption{WaitTime: 0})
+
+	router := sub.NewEventRouter(nil)
+	router.On("user.created", handleQueue2)
+	router.Default(func(ctx context.Context, id string, message *string) error {
+		log.Print("unhandled event", id, *message)
+		return nil
+	})
+	subscriber.SetHandler(awsPrefix+"Queue2", router.Route, &sub.HandlerOption{WaitTime: 0})
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		if err := subscriber.Subscribe(); err != nil {
+		defer wg.Done()
+		if err := subscriber.Subscribe(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			log.Print(err)
 			os.Exit(1)
 		}
-		wg.Done()
 	}()
 
-	publisher := pub.NewPublisher(client)
+	publisher := pub.NewPublisher(client, pub.NewJSONMarshaler())
 
-	if err := publisher.Publish(awsPrefix+"SNSTopic", map[string]interface{}{
+	if err := publisher.Publish(ctx, awsPrefix+"SNSTopic", map[string]interface{}{
 		"title": "test-title",
 		"body":  "test-body",
 	}); err != nil {
@@ -47,7 +63,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := publisher.SendMessage(awsPrefix+"Queue1", map[string]interface{}{
+	if err := publisher.SendMessage(ctx, awsPrefix+"Queue1", map[string]interface{}{
 		"title": "test-title2",
 		"body":  "test-body2",
 	}); err != nil {
@@ -58,11 +74,11 @@ func main() {
 	wg.Wait()
 }
 
-func handleQueue1(id string, message *string) error {
+func handleQueue1(ctx context.Context, id string, message *string) error {
 	log.Print("handleQueue1", id, *message)
 	return errors.New("error handleQueue1")
 }
-func handleQueue2(id string, message *string) error {
+func handleQueue2(ctx context.Context, id string, message *string) error {
 	log.Print("handleQueue2", id, *message)
 	return nil
 }
@@ -0,0 +1,104 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// BatchResult は バッチ送信 1 件分の結果です。objs と同じ順序・長さのスライスで返されます
+type BatchResult struct {
+	Success bool
+	Error   error
+}
+
+func (t *publisher) PublishBatch(ctx context.Context, topicName string, objs []interface{}) ([]BatchResult, error) {
+	id, err := t.client.GetTopicID(ctx, topicName, t.topicConfigs[topicName])
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(objs))
+	for start := 0; start < len(objs); start += broker.MaxBatchSize {
+		end := start + broker.MaxBatchSize
+		if end > len(objs) {
+			end = len(objs)
+		}
+
+		entries, indexByID := t.buildBatchEntries(objs, start, end, results)
+		entries = t.withSubject(entries, topicName)
+		if len(entries) == 0 {
+			continue
+		}
+
+		res, err := t.client.PublishBatch(ctx, &broker.PublishBatchArgs{TopicID: id, Entries: entries})
+		if err != nil {
+			return results, err
+		}
+		applyBatchFailures(results, indexByID, res.Failed)
+	}
+	return results, nil
+}
+
+func (t *publisher) SendMessageBatch(ctx context.Context, queueName string, objs []interface{}) ([]BatchResult, error) {
+	id, err := t.client.GetQueueID(ctx, queueName, t.queueConfigs[queueName])
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(objs))
+	for start := 0; start < len(objs); start += broker.MaxBatchSize {
+		end := start + broker.MaxBatchSize
+		if end > len(objs) {
+			end = len(objs)
+		}
+
+		entries, indexByID := t.buildBatchEntries(objs, start, end, results)
+		if len(entries) == 0 {
+			continue
+		}
+
+		res, err := t.client.SendMessageBatch(ctx, &broker.SendMessageBatchArgs{QueueID: id, Entries: entries})
+		if err != nil {
+			return results, err
+		}
+		applyBatchFailures(results, indexByID, res.Failed)
+	}
+	return results, nil
+}
+
+// buildBatchEntries は objs[start:end] をマーシャリングし、チャンク内連番を ID とする broker.BatchEntry を組み立てます。
+// マーシャリングに失敗したインデックスは results に直接エラーを記録し、エントリには含めません
+func (t *publisher) buildBatchEntries(objs []interface{}, start, end int, results []BatchResult) ([]broker.BatchEntry, map[string]int) {
+	entries := make([]broker.BatchEntry, 0, end-start)
+	indexByID := make(map[string]int, end-start)
+	for i := start; i < end; i++ {
+		message, attributes, err := t.marshaler.Marshal(objs[i])
+		if err != nil {
+			results[i] = BatchResult{Error: err}
+			continue
+		}
+		id := strconv.Itoa(i - start)
+		entries = append(entries, broker.BatchEntry{ID: id, Message: message, MessageAttributes: attributes})
+		indexByID[id] = i
+		results[i] = BatchResult{Success: true}
+	}
+	return entries, indexByID
+}
+
+func (t *publisher) withSubject(entries []broker.BatchEntry, subject string) []broker.BatchEntry {
+	for i := range entries {
+		entries[i].Subject = subject
+	}
+	return entries
+}
+
+func applyBatchFailures(results []BatchResult, indexByID map[string]int, failed []broker.BatchEntryError) {
+	for _, entry := range failed {
+		if i, ok := indexByID[entry.ID]; ok {
+			results[i] = BatchResult{Error: fmt.Errorf("%s: %s", entry.Code, entry.Message)}
+		}
+	}
+}
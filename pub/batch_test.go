@@ -0,0 +1,151 @@
+package pub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"github.com/wakuwaku3/example-pubsub.go/broker/memory"
+)
+
+// recordingBatchBroker は broker/memory.Broker をラップし、PublishBatch/SendMessageBatch を実配送せずに
+// 呼び出しごとの Entries を記録し、Message に "FAIL" を含むエントリだけを失敗させます。
+// pub.batch.go のチャンク分割・部分失敗マッピングのロジックをブローカーの実装詳細から切り離してテストするためのものです
+type recordingBatchBroker struct {
+	broker.Broker
+	publishBatches [][]broker.BatchEntry
+	sendBatches    [][]broker.BatchEntry
+}
+
+func (t *recordingBatchBroker) PublishBatch(ctx context.Context, args *broker.PublishBatchArgs) (*broker.BatchResult, error) {
+	t.publishBatches = append(t.publishBatches, args.Entries)
+	return &broker.BatchResult{Failed: failingEntries(args.Entries)}, nil
+}
+
+func (t *recordingBatchBroker) SendMessageBatch(ctx context.Context, args *broker.SendMessageBatchArgs) (*broker.BatchResult, error) {
+	t.sendBatches = append(t.sendBatches, args.Entries)
+	return &broker.BatchResult{Failed: failingEntries(args.Entries)}, nil
+}
+
+func failingEntries(entries []broker.BatchEntry) []broker.BatchEntryError {
+	var failed []broker.BatchEntryError
+	for _, entry := range entries {
+		if strings.Contains(entry.Message, "FAIL") {
+			failed = append(failed, broker.BatchEntryError{ID: entry.ID, Code: "Internal", Message: "simulated failure"})
+		}
+	}
+	return failed
+}
+
+func newTestPublisher(t *testing.T, client broker.Broker) Publisher {
+	t.Helper()
+	p := NewPublisher(client, NewJSONMarshaler())
+	p.SetTopicConfig("topic", &broker.TopicConfigAttributes{})
+	p.SetQueueConfig("queue", &broker.QueueConfigAttributes{})
+	return p
+}
+
+func TestPublishBatch_ChunksAtMaxBatchSize(t *testing.T) {
+	client := &recordingBatchBroker{Broker: memory.NewBroker()}
+	publisher := newTestPublisher(t, client)
+
+	objs := make([]interface{}, broker.MaxBatchSize+1)
+	for i := range objs {
+		objs[i] = map[string]interface{}{"i": i}
+	}
+
+	results, err := publisher.PublishBatch(context.Background(), "topic", objs)
+	if err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	if len(client.publishBatches) != 2 {
+		t.Fatalf("expected %d objects to be split into 2 chunks, got %d", len(objs), len(client.publishBatches))
+	}
+	if len(client.publishBatches[0]) != broker.MaxBatchSize {
+		t.Fatalf("expected the first chunk to contain %d entries, got %d", broker.MaxBatchSize, len(client.publishBatches[0]))
+	}
+	if len(client.publishBatches[1]) != 1 {
+		t.Fatalf("expected the second chunk to contain the 1 remaining entry, got %d", len(client.publishBatches[1]))
+	}
+	for i, result := range results {
+		if !result.Success || result.Error != nil {
+			t.Fatalf("expected objs[%d] to succeed, got %+v", i, result)
+		}
+	}
+}
+
+func TestPublishBatch_PropagatesPartialFailuresByID(t *testing.T) {
+	client := &recordingBatchBroker{Broker: memory.NewBroker()}
+	publisher := newTestPublisher(t, client)
+
+	objs := []interface{}{
+		map[string]interface{}{"marker": "ok"},
+		map[string]interface{}{"marker": "FAIL"},
+		map[string]interface{}{"marker": "ok"},
+	}
+
+	results, err := publisher.PublishBatch(context.Background(), "topic", objs)
+	if err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	if len(results) != len(objs) {
+		t.Fatalf("expected %d results, got %d", len(objs), len(results))
+	}
+	for i, result := range results {
+		wantFailure := i == 1
+		if wantFailure && result.Error == nil {
+			t.Fatalf("expected objs[%d] to have failed, got %+v", i, result)
+		}
+		if !wantFailure && (!result.Success || result.Error != nil) {
+			t.Fatalf("expected objs[%d] to succeed, got %+v", i, result)
+		}
+	}
+}
+
+func TestSendMessageBatch_ChunksAtMaxBatchSize(t *testing.T) {
+	client := &recordingBatchBroker{Broker: memory.NewBroker()}
+	publisher := newTestPublisher(t, client)
+
+	objs := make([]interface{}, broker.MaxBatchSize*2)
+	for i := range objs {
+		objs[i] = map[string]interface{}{"i": i}
+	}
+
+	if _, err := publisher.SendMessageBatch(context.Background(), "queue", objs); err != nil {
+		t.Fatalf("SendMessageBatch: %v", err)
+	}
+	if len(client.sendBatches) != 2 {
+		t.Fatalf("expected %d objects to be split into 2 chunks of %d, got %d chunks", len(objs), broker.MaxBatchSize, len(client.sendBatches))
+	}
+	for i, chunk := range client.sendBatches {
+		if len(chunk) != broker.MaxBatchSize {
+			t.Fatalf("expected chunk %d to contain %d entries, got %d", i, broker.MaxBatchSize, len(chunk))
+		}
+		for j, entry := range chunk {
+			if entry.ID != strconv.Itoa(j) {
+				t.Fatalf("expected chunk-local entry IDs to restart at 0, got %q at position %d", entry.ID, j)
+			}
+		}
+	}
+}
+
+func TestPublishBatch_MarshalErrorIsReportedWithoutCallingBroker(t *testing.T) {
+	client := &recordingBatchBroker{Broker: memory.NewBroker()}
+	publisher := newTestPublisher(t, client)
+
+	// json.Marshal が失敗するオブジェクト(channel は JSON 化できない)
+	objs := []interface{}{make(chan int)}
+
+	results, err := publisher.PublishBatch(context.Background(), "topic", objs)
+	if err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected a marshal error to be reported in results, got %+v", results)
+	}
+	if len(client.publishBatches) != 0 {
+		t.Fatalf("expected the broker not to be called when every entry in the chunk fails to marshal")
+	}
+}
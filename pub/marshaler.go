@@ -0,0 +1,32 @@
+package pub
+
+import "encoding/json"
+
+const (
+	// ContentTypeAttribute は MessageAttributes に設定される Content-Type のキーです
+	ContentTypeAttribute = "Content-Type"
+	// EventTypeAttribute は MessageAttributes に設定されるイベント種別のキーです
+	EventTypeAttribute = "Event-Type"
+)
+
+// Marshaler は obj を送信メッセージの本文と MessageAttributes にエンコードします
+type Marshaler interface {
+	Marshal(obj interface{}) (body string, attributes map[string]string, err error)
+}
+
+type jsonMarshaler struct{}
+
+// NewJSONMarshaler は obj を json.Marshal でエンコードする Marshaler を生成します
+func NewJSONMarshaler() Marshaler {
+	return &jsonMarshaler{}
+}
+
+func (t *jsonMarshaler) Marshal(obj interface{}) (string, map[string]string, error) {
+	messageBytes, err := json.Marshal(obj)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(messageBytes), map[string]string{
+		ContentTypeAttribute: "application/json",
+	}, nil
+}
@@ -0,0 +1,27 @@
+package pub
+
+import (
+	"github.com/hamba/avro"
+)
+
+type avroMarshaler struct {
+	schema   avro.Schema
+	schemaID string
+}
+
+// NewAvroMarshaler は obj を schema に基づいて Avro バイナリへエンコードする Marshaler を生成します
+// schemaID は受信側がスキーマを解決するために MessageAttributes へ付与されます
+func NewAvroMarshaler(schema avro.Schema, schemaID string) Marshaler {
+	return &avroMarshaler{schema, schemaID}
+}
+
+func (t *avroMarshaler) Marshal(obj interface{}) (string, map[string]string, error) {
+	messageBytes, err := avro.Marshal(t.schema, obj)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(messageBytes), map[string]string{
+		ContentTypeAttribute: "application/avro",
+		"Schema-Id":          t.schemaID,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package pub
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+type cloudEventsMarshaler struct {
+	source    string
+	eventType string
+}
+
+// NewCloudEventsMarshaler は obj を CloudEvents の structured JSON 形式でエンコードする Marshaler を生成します
+func NewCloudEventsMarshaler(source string, eventType string) Marshaler {
+	return &cloudEventsMarshaler{source, eventType}
+}
+
+func (t *cloudEventsMarshaler) Marshal(obj interface{}) (string, map[string]string, error) {
+	event := cloudevents.NewEvent()
+	event.SetSource(t.source)
+	event.SetType(t.eventType)
+	event.SetID(uuid.NewString())
+	if err := event.SetData(cloudevents.ApplicationJSON, obj); err != nil {
+		return "", nil, err
+	}
+
+	messageBytes, err := event.MarshalJSON()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(messageBytes), map[string]string{
+		ContentTypeAttribute: "application/cloudevents+json",
+		EventTypeAttribute:   t.eventType,
+	}, nil
+}
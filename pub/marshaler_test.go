@@ -0,0 +1,93 @@
+package pub
+
+import (
+	"encoding/json"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/hamba/avro"
+)
+
+func TestJSONMarshaler_RoundTrip(t *testing.T) {
+	marshaler := NewJSONMarshaler()
+	body, attributes, err := marshaler.Marshal(map[string]interface{}{"title": "hello"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if attributes[ContentTypeAttribute] != "application/json" {
+		t.Fatalf("expected %s attribute to be application/json, got %q", ContentTypeAttribute, attributes[ContentTypeAttribute])
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if decoded["title"] != "hello" {
+		t.Fatalf("expected round-tripped title %q, got %q", "hello", decoded["title"])
+	}
+}
+
+func TestAvroMarshaler_RoundTrip(t *testing.T) {
+	schema := avro.MustParse(`{
+		"type": "record",
+		"name": "testRecord",
+		"fields": [{"name": "title", "type": "string"}]
+	}`)
+	marshaler := NewAvroMarshaler(schema, "schema-123")
+
+	type record struct {
+		Title string `avro:"title"`
+	}
+	body, attributes, err := marshaler.Marshal(record{Title: "hello"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if attributes[ContentTypeAttribute] != "application/avro" {
+		t.Fatalf("expected %s attribute to be application/avro, got %q", ContentTypeAttribute, attributes[ContentTypeAttribute])
+	}
+	if attributes["Schema-Id"] != "schema-123" {
+		t.Fatalf("expected Schema-Id attribute %q, got %q", "schema-123", attributes["Schema-Id"])
+	}
+
+	var decoded record
+	if err := avro.Unmarshal(schema, []byte(body), &decoded); err != nil {
+		t.Fatalf("avro.Unmarshal: %v", err)
+	}
+	if decoded.Title != "hello" {
+		t.Fatalf("expected round-tripped title %q, got %q", "hello", decoded.Title)
+	}
+}
+
+func TestCloudEventsMarshaler_RoundTrip(t *testing.T) {
+	marshaler := NewCloudEventsMarshaler("my-source", "user.created")
+
+	body, attributes, err := marshaler.Marshal(map[string]interface{}{"id": "123"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if attributes[ContentTypeAttribute] != "application/cloudevents+json" {
+		t.Fatalf("expected %s attribute to be application/cloudevents+json, got %q", ContentTypeAttribute, attributes[ContentTypeAttribute])
+	}
+	if attributes[EventTypeAttribute] != "user.created" {
+		t.Fatalf("expected %s attribute %q, got %q", EventTypeAttribute, "user.created", attributes[EventTypeAttribute])
+	}
+
+	event := cloudevents.NewEvent()
+	if err := event.UnmarshalJSON([]byte(body)); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if event.Source() != "my-source" {
+		t.Fatalf("expected source %q, got %q", "my-source", event.Source())
+	}
+	if event.Type() != "user.created" {
+		t.Fatalf("expected type %q, got %q", "user.created", event.Type())
+	}
+
+	var data map[string]interface{}
+	if err := event.DataAs(&data); err != nil {
+		t.Fatalf("DataAs: %v", err)
+	}
+	if data["id"] != "123" {
+		t.Fatalf("expected round-tripped id %q, got %q", "123", data["id"])
+	}
+}
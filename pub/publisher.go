@@ -1,60 +1,104 @@
 package pub
 
 import (
-	"encoding/json"
+	"context"
 
-	"github.com/wakuwaku3/example-pubsub.go/aws"
+	"github.com/wakuwaku3/example-pubsub.go/broker"
 )
 
 type (
 	publisher struct {
-		client aws.Client
+		client       broker.Broker
+		marshaler    Marshaler
+		topicConfigs map[string]*broker.TopicConfigAttributes
+		queueConfigs map[string]*broker.QueueConfigAttributes
 	}
 	// Publisher は メッセージを公開します
 	Publisher interface {
-		Publish(topicName string, obj interface{}) error
-		SendMessage(queueName string, obj interface{}) error
+		Publish(ctx context.Context, topicName string, obj interface{}, opt ...*FifoOption) error
+		SendMessage(ctx context.Context, queueName string, obj interface{}, opt ...*FifoOption) error
+		// PublishBatch は objs を 10 件ずつのチャンクに分けて SNS PublishBatch で公開します
+		PublishBatch(ctx context.Context, topicName string, objs []interface{}) ([]BatchResult, error)
+		// SendMessageBatch は objs を 10 件ずつのチャンクに分けて SQS SendMessageBatch で送信します
+		SendMessageBatch(ctx context.Context, queueName string, objs []interface{}) ([]BatchResult, error)
+		// SetTopicConfig を設定すると、存在しない topicName への Publish 時に CreateTopic で自動作成します。
+		// トピックごとに異なる設定を持てるよう、topicName をキーに保持します
+		SetTopicConfig(topicName string, config *broker.TopicConfigAttributes)
+		// SetQueueConfig を設定すると、存在しない queueName への SendMessage 時に CreateQueue で自動作成し、
+		// 既存のキューであれば属性の乖離を SetQueueAttributes で是正します。キューごとに異なる設定を持てるよう、
+		// queueName をキーに保持します
+		SetQueueConfig(queueName string, config *broker.QueueConfigAttributes)
+	}
+	// FifoOption は FIFO トピック・キュー向けの送信オプションです
+	FifoOption struct {
+		MessageGroupID         string
+		MessageDeduplicationID string
 	}
 )
 
 // NewPublisher はインスタンスを生成します
-func NewPublisher(client aws.Client) Publisher {
-	return &publisher{client}
+func NewPublisher(client broker.Broker, marshaler Marshaler) Publisher {
+	return &publisher{
+		client:       client,
+		marshaler:    marshaler,
+		topicConfigs: make(map[string]*broker.TopicConfigAttributes),
+		queueConfigs: make(map[string]*broker.QueueConfigAttributes),
+	}
+}
+
+func (t *publisher) SetTopicConfig(topicName string, config *broker.TopicConfigAttributes) {
+	t.topicConfigs[topicName] = config
+}
+
+func (t *publisher) SetQueueConfig(queueName string, config *broker.QueueConfigAttributes) {
+	t.queueConfigs[queueName] = config
 }
 
-func (t *publisher) Publish(topicName string, obj interface{}) error {
-	messageBytes, err := json.Marshal(obj)
+func (t *publisher) Publish(ctx context.Context, topicName string, obj interface{}, opt ...*FifoOption) error {
+	message, attributes, err := t.marshaler.Marshal(obj)
 	if err != nil {
 		return err
 	}
 
-	id, err := t.client.GetTopicID(topicName)
+	id, err := t.client.GetTopicID(ctx, topicName, t.topicConfigs[topicName])
 	if err != nil {
 		return err
 	}
 
-	err = t.client.Publish(&aws.PublishArgs{
-		Message: string(messageBytes),
-		Subject: topicName,
-		TopicID: id,
-	})
-	return err
+	args := &broker.PublishArgs{
+		Message:           message,
+		Subject:           topicName,
+		TopicID:           id,
+		MessageAttributes: attributes,
+	}
+	applyFifoOption(opt, &args.MessageGroupID, &args.MessageDeduplicationID)
+	return t.client.Publish(ctx, args)
 }
 
-func (t *publisher) SendMessage(queueName string, obj interface{}) error {
-	messageBytes, err := json.Marshal(obj)
+func (t *publisher) SendMessage(ctx context.Context, queueName string, obj interface{}, opt ...*FifoOption) error {
+	message, attributes, err := t.marshaler.Marshal(obj)
 	if err != nil {
 		return err
 	}
 
-	id, err := t.client.GetQueueID(queueName)
+	id, err := t.client.GetQueueID(ctx, queueName, t.queueConfigs[queueName])
 	if err != nil {
 		return err
 	}
 
-	err = t.client.SendMessage(&aws.SendMessageArgs{
-		Message: string(messageBytes),
-		QueueID: id,
-	})
-	return err
+	args := &broker.SendMessageArgs{
+		Message:           message,
+		QueueID:           id,
+		MessageAttributes: attributes,
+	}
+	applyFifoOption(opt, &args.MessageGroupID, &args.MessageDeduplicationID)
+	return t.client.SendMessage(ctx, args)
+}
+
+func applyFifoOption(opt []*FifoOption, messageGroupID *string, messageDeduplicationID *string) {
+	if len(opt) == 0 || opt[0] == nil {
+		return
+	}
+	*messageGroupID = opt[0].MessageGroupID
+	*messageDeduplicationID = opt[0].MessageDeduplicationID
 }
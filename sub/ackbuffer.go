@@ -0,0 +1,102 @@
+package sub
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// ackBuffer は ack/nack を最大 broker.MaxBatchSize 件、または flushInterval ごとにまとめて
+// DeleteMessageBatch / ChangeMessageVisibilityBatch として送信します
+type ackBuffer struct {
+	client  broker.Broker
+	queueID string
+
+	mu      sync.Mutex
+	success []string
+	failure []failureEntry
+}
+
+type failureEntry struct {
+	receiptHandle string
+	waitTime      int64
+}
+
+func newAckBuffer(client broker.Broker, queueID string) *ackBuffer {
+	return &ackBuffer{client: client, queueID: queueID}
+}
+
+func (t *ackBuffer) addSuccess(ctx context.Context, receiptHandle string) error {
+	t.mu.Lock()
+	t.success = append(t.success, receiptHandle)
+	pending := t.drainSuccessLocked()
+	t.mu.Unlock()
+	return t.flushSuccess(ctx, pending)
+}
+
+func (t *ackBuffer) addFailure(ctx context.Context, receiptHandle string, waitTime int64) error {
+	t.mu.Lock()
+	t.failure = append(t.failure, failureEntry{receiptHandle, waitTime})
+	pending := t.drainFailureLocked()
+	t.mu.Unlock()
+	return t.flushFailure(ctx, pending)
+}
+
+// flush は溜まっている ack/nack をすべて送信します。Subscribe の終了時、および AckFlushInterval ごとに呼ばれます
+func (t *ackBuffer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	success := t.success
+	t.success = nil
+	failure := t.failure
+	t.failure = nil
+	t.mu.Unlock()
+
+	if err := t.flushSuccess(ctx, success); err != nil {
+		return err
+	}
+	return t.flushFailure(ctx, failure)
+}
+
+func (t *ackBuffer) drainSuccessLocked() []string {
+	if len(t.success) < broker.MaxBatchSize {
+		return nil
+	}
+	pending := t.success
+	t.success = nil
+	return pending
+}
+
+func (t *ackBuffer) drainFailureLocked() []failureEntry {
+	if len(t.failure) < broker.MaxBatchSize {
+		return nil
+	}
+	pending := t.failure
+	t.failure = nil
+	return pending
+}
+
+func (t *ackBuffer) flushSuccess(ctx context.Context, receiptHandles []string) error {
+	if len(receiptHandles) == 0 {
+		return nil
+	}
+	entries := make([]broker.BatchReceiptHandle, len(receiptHandles))
+	for i, receiptHandle := range receiptHandles {
+		entries[i] = broker.BatchReceiptHandle{ID: strconv.Itoa(i), ReceiptHandle: receiptHandle}
+	}
+	_, err := t.client.ReportSuccessMessages(ctx, &broker.ReportSuccessMessagesArgs{QueueID: t.queueID, Entries: entries})
+	return err
+}
+
+func (t *ackBuffer) flushFailure(ctx context.Context, failures []failureEntry) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	entries := make([]broker.BatchVisibilityEntry, len(failures))
+	for i, failure := range failures {
+		entries[i] = broker.BatchVisibilityEntry{ID: strconv.Itoa(i), ReceiptHandle: failure.receiptHandle, WaitTime: failure.waitTime}
+	}
+	_, err := t.client.ReportFailureMessages(ctx, &broker.ReportFailureMessagesArgs{QueueID: t.queueID, Entries: entries})
+	return err
+}
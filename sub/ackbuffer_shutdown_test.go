@@ -0,0 +1,94 @@
+package sub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"github.com/wakuwaku3/example-pubsub.go/broker/memory"
+)
+
+// ctxHonoringBroker は broker/memory.Broker をラップし、ctx が既にキャンセルされていれば
+// 実 AWS SDK (*WithContext) と同様に即座にエラーを返します。broker/memory は ctx を無視するため、
+// ctx をそのまま最終フラッシュに使ってしまう回帰をこのラッパーなしでは検知できません
+type ctxHonoringBroker struct {
+	broker.Broker
+}
+
+func (t *ctxHonoringBroker) ReportSuccessMessages(ctx context.Context, args *broker.ReportSuccessMessagesArgs) (*broker.BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.Broker.ReportSuccessMessages(ctx, args)
+}
+
+func (t *ctxHonoringBroker) ReportFailureMessages(ctx context.Context, args *broker.ReportFailureMessagesArgs) (*broker.BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.Broker.ReportFailureMessages(ctx, args)
+}
+
+// TestSubscribe_FlushesAckBufferOnShutdownDespiteCanceledContext は、ハンドラが成功した後でも
+// 10 件・AckFlushInterval 未満のうちに ctx がキャンセルされた場合、最終フラッシュが
+// "既にキャンセルされた ctx" で送られてエラーになり ack が失われる回帰を防ぎます
+func TestSubscribe_FlushesAckBufferOnShutdownDespiteCanceledContext(t *testing.T) {
+	m := memory.NewBroker()
+	ctx := context.Background()
+	visibilityTimeout := int64(1)
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{VisibilityTimeout: &visibilityTimeout}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+	client := &ctxHonoringBroker{Broker: m}
+
+	subscriber, err := NewSubscriber(client, &SubscriberOption{
+		ConcurrencyMessageHandleLimit: 1,
+		AckFlushInterval:              time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	handled := make(chan struct{})
+	if err := subscriber.SetHandler("queue", func(ctx context.Context, id string, message *string) error {
+		close(handled)
+		return nil
+	}, &HandlerOption{WaitTime: 0}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	if err := client.SendMessage(ctx, &broker.SendMessageArgs{QueueID: "queue", Message: "msg"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- subscriber.Subscribe(subCtx) }()
+
+	select {
+	case <-handled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler was never invoked")
+	}
+	// ハンドラ成功直後、10 件/AckFlushInterval の閾値に満たないうちに shutdown する
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Subscribe to return ctx.Err() after cancellation")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe did not return after ctx was canceled")
+	}
+
+	// 最終フラッシュが成功していれば、VisibilityTimeout 経過後もメッセージは再配送されない
+	time.Sleep(time.Duration(visibilityTimeout+1) * time.Second)
+	res, err := m.ReceiveMessages(ctx, &broker.ReceiveMessagesArgs{QueueID: "queue"})
+	if err != nil {
+		t.Fatalf("ReceiveMessages: %v", err)
+	}
+	if len(res.ReceiveMessages) != 0 {
+		t.Fatalf("expected the successfully-handled message to have been acked on shutdown, but it was redelivered")
+	}
+}
@@ -0,0 +1,102 @@
+package sub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"github.com/wakuwaku3/example-pubsub.go/broker/memory"
+)
+
+func TestAckBuffer_FlushesAtMaxBatchSize(t *testing.T) {
+	ctx := context.Background()
+	m := memory.NewBroker()
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+	spy := newSpyBroker(m)
+
+	sendN(t, m, "queue", broker.MaxBatchSize+1)
+	receiptHandles := receiveN(t, m, "queue", broker.MaxBatchSize+1)
+
+	buffer := newAckBuffer(spy, "queue")
+	for _, rh := range receiptHandles[:broker.MaxBatchSize] {
+		if err := buffer.addSuccess(ctx, rh); err != nil {
+			t.Fatalf("addSuccess: %v", err)
+		}
+	}
+	if got := spy.successBatchCount(); got != 1 {
+		t.Fatalf("expected exactly 1 flush once MaxBatchSize entries are buffered, got %d", got)
+	}
+
+	if err := buffer.addSuccess(ctx, receiptHandles[broker.MaxBatchSize]); err != nil {
+		t.Fatalf("addSuccess: %v", err)
+	}
+	if got := spy.successBatchCount(); got != 1 {
+		t.Fatalf("expected no flush below MaxBatchSize, got %d batches", got)
+	}
+
+	if err := buffer.flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := spy.successBatchCount(); got != 2 {
+		t.Fatalf("expected flush() to drain the remaining entry, got %d batches", got)
+	}
+}
+
+func TestAckBuffer_FlushFailureReleasesWithWaitTime(t *testing.T) {
+	ctx := context.Background()
+	m := memory.NewBroker()
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+	spy := newSpyBroker(m)
+	sendN(t, m, "queue", 1)
+	receiptHandles := receiveN(t, m, "queue", 1)
+
+	buffer := newAckBuffer(spy, "queue")
+	if err := buffer.addFailure(ctx, receiptHandles[0], 0); err != nil {
+		t.Fatalf("addFailure: %v", err)
+	}
+	if err := buffer.flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := spy.failureBatchCount(); got != 1 {
+		t.Fatalf("expected 1 failure batch flushed, got %d", got)
+	}
+
+	// waitTime 0 は即座に再可視化されるはずなので、もう一度 ReceiveMessages で取得できる
+	redelivered := receiveN(t, m, "queue", 1)
+	if len(redelivered) != 1 {
+		t.Fatalf("expected the nacked message to be redelivered, got %d messages", len(redelivered))
+	}
+}
+
+// sendN は queueID へ n 件のダミーメッセージを送信します
+func sendN(t *testing.T, b broker.Broker, queueID string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := b.SendMessage(context.Background(), &broker.SendMessageArgs{QueueID: queueID, Message: "msg"}); err != nil {
+			t.Fatalf("SendMessage: %v", err)
+		}
+	}
+}
+
+// receiveN は ReceiveMessages を必要なだけ繰り返し呼び出し、合計 n 件の ReceiptHandle を集めます
+func receiveN(t *testing.T, b broker.Broker, queueID string, n int) []string {
+	t.Helper()
+	receiptHandles := make([]string, 0, n)
+	for len(receiptHandles) < n {
+		res, err := b.ReceiveMessages(context.Background(), &broker.ReceiveMessagesArgs{QueueID: queueID})
+		if err != nil {
+			t.Fatalf("ReceiveMessages: %v", err)
+		}
+		if len(res.ReceiveMessages) == 0 {
+			t.Fatalf("ReceiveMessages returned no messages before reaching %d", n)
+		}
+		for _, msg := range res.ReceiveMessages {
+			receiptHandles = append(receiptHandles, msg.ReceiptHandle)
+		}
+	}
+	return receiptHandles
+}
@@ -0,0 +1,47 @@
+package sub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// spyBroker は broker/memory.Broker に ack/nack バッチ呼び出しの記録を付け加えるテスト用の薄いラッパーです
+type spyBroker struct {
+	broker.Broker
+
+	mu             sync.Mutex
+	successBatches [][]broker.BatchReceiptHandle
+	failureBatches [][]broker.BatchVisibilityEntry
+}
+
+func newSpyBroker(underlying broker.Broker) *spyBroker {
+	return &spyBroker{Broker: underlying}
+}
+
+func (t *spyBroker) ReportSuccessMessages(ctx context.Context, args *broker.ReportSuccessMessagesArgs) (*broker.BatchResult, error) {
+	t.mu.Lock()
+	t.successBatches = append(t.successBatches, args.Entries)
+	t.mu.Unlock()
+	return t.Broker.ReportSuccessMessages(ctx, args)
+}
+
+func (t *spyBroker) ReportFailureMessages(ctx context.Context, args *broker.ReportFailureMessagesArgs) (*broker.BatchResult, error) {
+	t.mu.Lock()
+	t.failureBatches = append(t.failureBatches, args.Entries)
+	t.mu.Unlock()
+	return t.Broker.ReportFailureMessages(ctx, args)
+}
+
+func (t *spyBroker) successBatchCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.successBatches)
+}
+
+func (t *spyBroker) failureBatchCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.failureBatches)
+}
@@ -0,0 +1,58 @@
+package sub
+
+import "context"
+
+type contextKey int
+
+const (
+	queueNameContextKey contextKey = iota
+	receiveCountContextKey
+	messageAttributesContextKey
+	attributesContextKey
+	visibilityOverrideContextKey
+)
+
+// QueueNameFromContext は処理中のメッセージが属するキュー名を取得します
+func QueueNameFromContext(ctx context.Context) (string, bool) {
+	value, ok := ctx.Value(queueNameContextKey).(string)
+	return value, ok
+}
+
+// ReceiveCountFromContext は SQS の ApproximateReceiveCount 属性(これまでの受信回数)を取得します
+func ReceiveCountFromContext(ctx context.Context) (int64, bool) {
+	value, ok := ctx.Value(receiveCountContextKey).(int64)
+	return value, ok
+}
+
+// MessageAttributesFromContext はメッセージの MessageAttributes を取得します
+func MessageAttributesFromContext(ctx context.Context) (map[string]string, bool) {
+	value, ok := ctx.Value(messageAttributesContextKey).(map[string]string)
+	return value, ok
+}
+
+// AttributesFromContext はメッセージのシステム属性(ApproximateReceiveCount、SNS 由来の Subject など)を取得します。
+// ApproximateReceiveCount 以外は HandlerOption.AttributeNames で明示的に要求したものだけが含まれます
+func AttributesFromContext(ctx context.Context) (map[string]string, bool) {
+	value, ok := ctx.Value(attributesContextKey).(map[string]string)
+	return value, ok
+}
+
+// OverrideVisibilityTimeout はハンドラが失敗した際の VisibilityTimeout(秒)をミドルウェアから上書きします。
+// 呼び出されなかった場合は HandlerOption.WaitTime がそのまま使用されます
+func OverrideVisibilityTimeout(ctx context.Context, seconds int64) {
+	if box, ok := ctx.Value(visibilityOverrideContextKey).(*int64); ok {
+		*box = seconds
+	}
+}
+
+// Use はメッセージ処理パイプラインに Middleware を積み重ねます。先に登録したものほど外側(先に実行)になります
+func (t *subscriber) Use(mw ...Middleware) {
+	t.middlewares = append(t.middlewares, mw...)
+}
+
+func (t *subscriber) compose(handler Handler) Handler {
+	for i := len(t.middlewares) - 1; i >= 0; i-- {
+		handler = t.middlewares[i](handler)
+	}
+	return handler
+}
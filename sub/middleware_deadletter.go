@@ -0,0 +1,37 @@
+package sub
+
+import (
+	"context"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+)
+
+// NewDeadLetterMiddleware は失敗が maxAttempts 回に達したメッセージを dlqQueueName へ SendMessage したうえで
+// 元のメッセージを ack 済み扱いにします(内部で nil を返すので、呼び出し元では ack バッファ経由で ReportSuccessMessages が実行されます)
+func NewDeadLetterMiddleware(client broker.Broker, dlqQueueName string, maxAttempts int64) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, id string, message *string) error {
+			err := next(ctx, id, message)
+			if err == nil {
+				return nil
+			}
+
+			receiveCount, ok := ReceiveCountFromContext(ctx)
+			if !ok || receiveCount < maxAttempts {
+				return err
+			}
+
+			dlqID, idErr := client.GetQueueID(ctx, dlqQueueName, nil)
+			if idErr != nil {
+				return idErr
+			}
+			if sendErr := client.SendMessage(ctx, &broker.SendMessageArgs{
+				QueueID: dlqID,
+				Message: *message,
+			}); sendErr != nil {
+				return sendErr
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package sub
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewMetricsMiddleware はキューごとのハンドル件数・所要時間・同時実行数を registerer に登録し、
+// メッセージの処理をその Prometheus メトリクスで計測します
+func NewMetricsMiddleware(registerer prometheus.Registerer) Middleware {
+	handled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pubsub_sub_messages_handled_total",
+		Help: "Total number of messages handled, partitioned by queue and result.",
+	}, []string{"queue", "result"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "pubsub_sub_handle_duration_seconds",
+		Help: "Handler latency in seconds, partitioned by queue.",
+	}, []string{"queue"})
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pubsub_sub_messages_in_flight",
+		Help: "Number of messages currently being handled, partitioned by queue.",
+	}, []string{"queue"})
+	registerer.MustRegister(handled, duration, inFlight)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, id string, message *string) error {
+			queueName, _ := QueueNameFromContext(ctx)
+
+			inFlight.WithLabelValues(queueName).Inc()
+			defer inFlight.WithLabelValues(queueName).Dec()
+
+			start := time.Now()
+			err := next(ctx, id, message)
+			duration.WithLabelValues(queueName).Observe(time.Since(start).Seconds())
+
+			result := "success"
+			if err != nil {
+				result = "failure"
+			}
+			handled.WithLabelValues(queueName, result).Inc()
+			return err
+		}
+	}
+}
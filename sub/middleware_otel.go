@@ -0,0 +1,29 @@
+package sub
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingMiddleware は MessageAttributes に伝播されたトレースコンテキストを取り出し、
+// ハンドラの実行をひとつの span として記録します
+func NewTracingMiddleware(tracer trace.Tracer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, id string, message *string) error {
+			attributes, _ := MessageAttributesFromContext(ctx)
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(attributes))
+
+			ctx, span := tracer.Start(ctx, "sub.Handle")
+			defer span.End()
+
+			err := next(ctx, id, message)
+			if err != nil {
+				span.RecordError(err)
+			}
+			return err
+		}
+	}
+}
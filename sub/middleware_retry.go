@@ -0,0 +1,39 @@
+package sub
+
+import (
+	"context"
+)
+
+// RetryOption は NewRetryMiddleware の オプションです
+type RetryOption struct {
+	// BaseVisibilityTimeout は指数バックオフの基数(秒)です。1 回目の受信(receiveCount=1)で失敗した場合は
+	// その 2 倍が適用されます
+	BaseVisibilityTimeout int64
+	// MaxVisibilityTimeout は VisibilityTimeout の上限(秒)です
+	MaxVisibilityTimeout int64
+}
+
+// NewRetryMiddleware は失敗時に ApproximateReceiveCount に基づいて
+// VisibilityTimeout = min(MaxVisibilityTimeout, BaseVisibilityTimeout * 2^receiveCount) の指数バックオフをかけます
+func NewRetryMiddleware(option *RetryOption) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, id string, message *string) error {
+			err := next(ctx, id, message)
+			if err == nil {
+				return err
+			}
+
+			receiveCount, ok := ReceiveCountFromContext(ctx)
+			if !ok {
+				return err
+			}
+
+			waitTime := option.BaseVisibilityTimeout << uint(receiveCount)
+			if waitTime > option.MaxVisibilityTimeout || (waitTime <= 0 && option.BaseVisibilityTimeout > 0) {
+				waitTime = option.MaxVisibilityTimeout
+			}
+			OverrideVisibilityTimeout(ctx, waitTime)
+			return err
+		}
+	}
+}
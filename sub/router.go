@@ -0,0 +1,124 @@
+package sub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// eventTypeMessageAttribute は CloudEvents のバイナリ/構造化モードで MessageAttributes に
+	// 設定されるイベント種別のキーです。pub.EventTypeAttribute と同じ値です(sub は pub に依存しないため、
+	// ここでは文字列として持っています)
+	eventTypeMessageAttribute = "Event-Type"
+	// subjectAttributeName は SNS から非 raw 配信された SQS メッセージのシステム属性に含まれる Subject のキーです。
+	// HandlerOption.AttributeNames に "Subject" を加えて購読した場合にのみ AttributesFromContext 経由で取得できます
+	subjectAttributeName = "Subject"
+)
+
+type (
+	eventRouter struct {
+		eventTypePath  string
+		handlers       map[string]Handler
+		defaultHandler Handler
+	}
+	// EventRouterOption は EventRouter の オプションです
+	EventRouterOption struct {
+		// EventTypePath は CloudEvents の type 属性にも SNS Subject にも一致しなかった場合に、
+		// 本文からイベント種別を取り出す JSON パスです(ドット区切り)。未設定の場合は "type" が使用されます
+		EventTypePath string
+	}
+	// EventRouter は メッセージの CloudEvents type 属性・SNS Subject・本文の JSON パスの順にイベント種別を
+	// 判定し、登録されたハンドラへ振り分けます
+	EventRouter interface {
+		// On は eventType に一致するメッセージを受け持つハンドラを登録します
+		On(eventType string, handler Handler)
+		// Default はどのハンドラにも一致しなかったメッセージを受け持つハンドラを登録します
+		Default(handler Handler)
+		// Route は Handler と同じシグネチャを持ち、SetHandler にそのまま渡せます。On/Default に登録した
+		// ハンドラも通常の Handler と同じ契約に従います: nil を返せば ack されてメッセージは削除され、
+		// エラーを返せば HandlerOption.WaitTime 秒(OverrideVisibilityTimeout で上書きされればその秒数)だけ
+		// visibility が延長されます
+		Route(ctx context.Context, id string, message *string) error
+	}
+)
+
+// NewEventRouter はインスタンスを生成します
+func NewEventRouter(option *EventRouterOption) EventRouter {
+	eventTypePath := "type"
+	if option != nil && option.EventTypePath != "" {
+		eventTypePath = option.EventTypePath
+	}
+	return &eventRouter{
+		eventTypePath: eventTypePath,
+		handlers:      make(map[string]Handler),
+	}
+}
+
+func (t *eventRouter) On(eventType string, handler Handler) {
+	t.handlers[eventType] = handler
+}
+
+func (t *eventRouter) Default(handler Handler) {
+	t.defaultHandler = handler
+}
+
+func (t *eventRouter) Route(ctx context.Context, id string, message *string) error {
+	eventType, err := t.extractEventType(ctx, message)
+	if err != nil {
+		if t.defaultHandler == nil {
+			return err
+		}
+		return t.defaultHandler(ctx, id, message)
+	}
+
+	if handler, ok := t.handlers[eventType]; ok {
+		return handler(ctx, id, message)
+	}
+	if t.defaultHandler == nil {
+		return fmt.Errorf("no handler registered for event type %s", eventType)
+	}
+	return t.defaultHandler(ctx, id, message)
+}
+
+// extractEventType は CloudEvents の type 属性、SNS の Subject、本文の EventTypePath の順に
+// イベント種別を探します。最初に見つかったものを採用します
+func (t *eventRouter) extractEventType(ctx context.Context, message *string) (string, error) {
+	if attributes, ok := MessageAttributesFromContext(ctx); ok {
+		if eventType, ok := attributes[eventTypeMessageAttribute]; ok && eventType != "" {
+			return eventType, nil
+		}
+	}
+	if attributes, ok := AttributesFromContext(ctx); ok {
+		if subject, ok := attributes[subjectAttributeName]; ok && subject != "" {
+			return subject, nil
+		}
+	}
+	return t.extractEventTypeFromBody(message)
+}
+
+func (t *eventRouter) extractEventTypeFromBody(message *string) (string, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(*message), &raw); err != nil {
+		return "", err
+	}
+
+	var cur interface{} = raw
+	for _, segment := range strings.Split(t.eventTypePath, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("event type path %q not found in message", t.eventTypePath)
+		}
+		cur, ok = m[segment]
+		if !ok {
+			return "", fmt.Errorf("event type path %q not found in message", t.eventTypePath)
+		}
+	}
+
+	eventType, ok := cur.(string)
+	if !ok {
+		return "", fmt.Errorf("event type path %q is not a string", t.eventTypePath)
+	}
+	return eventType, nil
+}
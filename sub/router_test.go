@@ -0,0 +1,154 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"github.com/wakuwaku3/example-pubsub.go/broker/memory"
+)
+
+func TestEventRouter_RoutesByCloudEventsTypeAttribute(t *testing.T) {
+	router := NewEventRouter(nil)
+	var routed string
+	router.On("user.created", func(ctx context.Context, id string, message *string) error {
+		routed = "user.created"
+		return nil
+	})
+	router.Default(func(ctx context.Context, id string, message *string) error {
+		routed = "default"
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), messageAttributesContextKey, map[string]string{
+		eventTypeMessageAttribute: "user.created",
+	})
+	message := `{"type":"other.event"}`
+	if err := router.Route(ctx, "id", &message); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if routed != "user.created" {
+		t.Fatalf("expected the CloudEvents type attribute to win over the body, got %q", routed)
+	}
+}
+
+func TestEventRouter_RoutesBySNSSubjectWhenNoTypeAttribute(t *testing.T) {
+	router := NewEventRouter(nil)
+	var routed string
+	router.On("user.deleted", func(ctx context.Context, id string, message *string) error {
+		routed = "user.deleted"
+		return nil
+	})
+	router.Default(func(ctx context.Context, id string, message *string) error {
+		routed = "default"
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), attributesContextKey, map[string]string{
+		subjectAttributeName: "user.deleted",
+	})
+	message := `{}`
+	if err := router.Route(ctx, "id", &message); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if routed != "user.deleted" {
+		t.Fatalf("expected the SNS Subject to be used as the event type, got %q", routed)
+	}
+}
+
+func TestEventRouter_FallsBackToEventTypePathOnBody(t *testing.T) {
+	router := NewEventRouter(&EventRouterOption{EventTypePath: "detail.eventType"})
+	var routed string
+	router.On("order.shipped", func(ctx context.Context, id string, message *string) error {
+		routed = "order.shipped"
+		return nil
+	})
+
+	message := `{"detail":{"eventType":"order.shipped"}}`
+	if err := router.Route(context.Background(), "id", &message); err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	if routed != "order.shipped" {
+		t.Fatalf("expected the body JSON path to be used as the event type, got %q", routed)
+	}
+}
+
+func TestEventRouter_UnmatchedTypeWithoutDefaultIsAnError(t *testing.T) {
+	router := NewEventRouter(nil)
+	router.On("user.created", func(ctx context.Context, id string, message *string) error { return nil })
+
+	message := `{"type":"user.deleted"}`
+	if err := router.Route(context.Background(), "id", &message); err == nil {
+		t.Fatal("expected an error for an unmatched event type with no default handler")
+	}
+}
+
+func TestSubscribe_EventRouterAcksAndExtendsVisibilityLikeAnyHandler(t *testing.T) {
+	m := memory.NewBroker()
+	ctx := context.Background()
+	visibilityTimeout := int64(1)
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{VisibilityTimeout: &visibilityTimeout}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+
+	router := NewEventRouter(nil)
+	acked := make(chan struct{})
+	router.On("user.created", func(ctx context.Context, id string, message *string) error {
+		close(acked)
+		return nil
+	})
+	failed := make(chan struct{})
+	var failedOnce bool
+	router.On("user.deleted", func(ctx context.Context, id string, message *string) error {
+		if !failedOnce {
+			failedOnce = true
+			close(failed)
+			return errors.New("not ready yet")
+		}
+		return nil
+	})
+
+	subscriber, err := NewSubscriber(m, &SubscriberOption{ConcurrencyMessageHandleLimit: 2})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	// WaitTime を十分大きくし、nack されたメッセージが再配送されるより先にアサーションできるようにする
+	if err := subscriber.SetHandler("queue", router.Route, &HandlerOption{WaitTime: 60}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go subscriber.Subscribe(subCtx)
+
+	if err := m.SendMessage(ctx, &broker.SendMessageArgs{QueueID: "queue", Message: `{"type":"user.created"}`}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if err := m.SendMessage(ctx, &broker.SendMessageArgs{QueueID: "queue", Message: `{"type":"user.deleted"}`}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	select {
+	case <-acked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("matched handler returning nil was never invoked")
+	}
+	select {
+	case <-failed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("matched handler returning an error was never invoked")
+	}
+
+	// ack 済みのメッセージは削除済みで、nack されたメッセージは WaitTime(60s) が経過するまで再配送されないはず。
+	// ここでは VisibilityTimeout(1s) 経過直後に確認することで、両方とも pending に積まれていないことを検証する
+	time.Sleep(time.Duration(visibilityTimeout+1) * time.Second)
+	res, err := m.ReceiveMessages(ctx, &broker.ReceiveMessagesArgs{QueueID: "queue"})
+	if err != nil {
+		t.Fatalf("ReceiveMessages: %v", err)
+	}
+	if len(res.ReceiveMessages) != 0 {
+		t.Fatalf("expected neither the acked message nor the still-nacked-with-WaitTime message to be pending, got %d messages", len(res.ReceiveMessages))
+	}
+}
@@ -1,130 +1,250 @@
 package sub
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/wakuwaku3/example-pubsub.go/aws"
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"golang.org/x/sync/errgroup"
 )
 
+// defaultAckFlushInterval は SubscriberOption.AckFlushInterval が未設定の場合に使われる既定値です
+const defaultAckFlushInterval = time.Second
+
+// shutdownFlushTimeout は Subscribe 終了時、処理済みだが未送信の ack/nack を最後にフラッシュする際のタイムアウトです
+const shutdownFlushTimeout = 5 * time.Second
+
 type (
 	subscriber struct {
-		client   aws.Client
-		handlers map[string]*struct {
-			handler Handler
-			option  *HandlerOption
-		}
-		option    *SubscriberOption
-		semaphore chan int
+		client      broker.Broker
+		handlers    map[string]*handlerEntry
+		option      *SubscriberOption
+		semaphore   chan int
+		unmarshaler Unmarshaler
+		middlewares []Middleware
+	}
+	// handlerEntry は 1 キューに紐づくハンドラの実体です。TypedHandler が設定されている場合は
+	// proto と同じ型を Unmarshaler でデコードしてから呼び出します
+	handlerEntry struct {
+		handler      Handler
+		proto        reflect.Type
+		typedHandler func(id string, msg interface{}) error
+		option       *HandlerOption
 	}
 	// SubscriberOption は Subscriber の オプションです
 	SubscriberOption struct {
 		ConcurrencyMessageHandleLimit int
+		// AckFlushInterval は ack/nack をバッチ送信するまでの最大待機時間です。未設定(0)の場合は 1 秒になります
+		AckFlushInterval time.Duration
 	}
 	// HandlerOption は Handler の オプションです
 	HandlerOption struct {
 		WaitTime int64
+		// QueueConfig を設定すると、このキューが購読開始時に存在しなければ CreateQueue で自動作成し、
+		// 既存であれば属性の乖離を SetQueueAttributes で是正します。キューごとに個別の設定を持てます
+		QueueConfig *broker.QueueConfigAttributes
+		// AttributeNames は ApproximateReceiveCount に加えて取得したいシステム属性です(例: EventRouter の
+		// SNS Subject 抽出に使う "Subject")。AttributesFromContext で参照できます
+		AttributeNames []string
 	}
 	// Subscriber は メッセージを購読します
 	Subscriber interface {
 		SetHandler(queueName string, handler Handler, option *HandlerOption) error
-		Subscribe() error
+		SetTypedHandler(queueName string, proto interface{}, handler func(id string, msg interface{}) error, option *HandlerOption) error
+		SetUnmarshaler(unmarshaler Unmarshaler)
+		// Use はハンドラの前後に実行する Middleware を登録します
+		Use(mw ...Middleware)
+		Subscribe(ctx context.Context) error
 	}
 	// Handler です
-	Handler func(id string, message *string) error
+	Handler func(ctx context.Context, id string, message *string) error
 	// Middleware です
 	Middleware func(next Handler) Handler
 )
 
 // NewSubscriber はインスタンスを生成します
-func NewSubscriber(client aws.Client, option *SubscriberOption) (Subscriber, error) {
+func NewSubscriber(client broker.Broker, option *SubscriberOption) (Subscriber, error) {
 	if option.ConcurrencyMessageHandleLimit < 1 {
 		return nil, errors.New("set 1 or more for ConcurrencyMessageHandleLimit")
 	}
-	return &subscriber{client, make(map[string]*struct {
-		handler Handler
-		option  *HandlerOption
-	}), option, make(chan int, option.ConcurrencyMessageHandleLimit)}, nil
+	return &subscriber{
+		client:      client,
+		handlers:    make(map[string]*handlerEntry),
+		option:      option,
+		semaphore:   make(chan int, option.ConcurrencyMessageHandleLimit),
+		unmarshaler: NewJSONUnmarshaler(),
+	}, nil
+}
+
+// SetUnmarshaler は SetTypedHandler がデコードに使う Unmarshaler を差し替えます。未設定時は JSON を使用します
+func (t *subscriber) SetUnmarshaler(unmarshaler Unmarshaler) {
+	t.unmarshaler = unmarshaler
 }
 
 func (t *subscriber) SetHandler(queueName string, handler Handler, option *HandlerOption) error {
 	if option.WaitTime < 0 {
 		return errors.New("set 0 or more for WaitTime")
 	}
-	t.handlers[queueName] = &struct {
-		handler Handler
-		option  *HandlerOption
-	}{
+	t.handlers[queueName] = &handlerEntry{
 		handler: handler,
 		option:  option,
 	}
 	return nil
 }
-func (t *subscriber) Subscribe() error {
-	chFatal := make(chan error)
-	go func() {
-		defer func() {
-			if info := recover(); info != nil {
-				chFatal <- errors.New(fmt.Sprint(info))
-			}
-		}()
-		for queueName, handler := range t.handlers {
-			id, err := t.client.GetQueueID(queueName)
+
+// SetTypedHandler は proto と同じ型のインスタンスへ本文をデコードしてから handler を呼び出します
+func (t *subscriber) SetTypedHandler(queueName string, proto interface{}, handler func(id string, msg interface{}) error, option *HandlerOption) error {
+	if option.WaitTime < 0 {
+		return errors.New("set 0 or more for WaitTime")
+	}
+	protoType := reflect.TypeOf(proto)
+	if protoType.Kind() == reflect.Ptr {
+		protoType = protoType.Elem()
+	}
+	t.handlers[queueName] = &handlerEntry{
+		proto:        protoType,
+		typedHandler: handler,
+		option:       option,
+	}
+	return nil
+}
+
+// Subscribe は ctx がキャンセルされるまで全キューをポーリングし続けます。
+// ctx がキャンセルされると新規の ReceiveMessage は行われず、実行中のハンドラの完了を待って ctx.Err() を返します。
+func (t *subscriber) Subscribe(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for queueName, handler := range t.handlers {
+		queueName, handler := queueName, handler
+		g.Go(func() error {
+			id, err := t.client.GetQueueID(ctx, queueName, handler.option.QueueConfig)
 			if err != nil {
-				chFatal <- err
+				return err
+			}
+			return t.poll(ctx, queueName, id, handler)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (t *subscriber) poll(ctx context.Context, queueName string, queueID string, handler *handlerEntry) (err error) {
+	buffer := newAckBuffer(t.client, queueID)
+	// ctx はこの defer が走る時点で既にキャンセルされているため、そのまま使うと
+	// broker への最終フラッシュが即座にエラーになる(既に処理済みのメッセージが再配送されてしまう)。
+	// ctx の値は引き継ぎつつキャンセルだけを切り離した短命な context でフラッシュする
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownFlushTimeout)
+		defer cancel()
+		if flushErr := buffer.flush(flushCtx); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}()
+
+	flushInterval := t.option.AckFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultAckFlushInterval
+	}
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
 				return
+			case <-flushTicker.C:
+				buffer.flush(ctx)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		res, err := t.client.ReceiveMessages(ctx, &broker.ReceiveMessagesArgs{
+			QueueID:        queueID,
+			AttributeNames: append([]string{"ApproximateReceiveCount"}, handler.option.AttributeNames...),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wgMessage := &sync.WaitGroup{}
+		errOnce := &sync.Once{}
+		var handleErr error
+		for _, msg := range res.ReceiveMessages {
+			select {
+			case t.semaphore <- 1:
+			case <-ctx.Done():
+				wgMessage.Wait()
+				return nil
 			}
 
-			go func(queueName string, queueID string, handler *struct {
-				handler Handler
-				option  *HandlerOption
-			}) {
-				for true {
-					res, err := t.client.ReceiveMessages(&aws.ReceiveMessagesArgs{
-						QueueID: queueID,
-					})
-					if err != nil {
-						chFatal <- err
-						return
+			wgMessage.Add(1)
+			go func(msg *broker.ReceiveMessage) {
+				defer wgMessage.Done()
+				defer func() { <-t.semaphore }()
+				defer func() {
+					if info := recover(); info != nil {
+						errOnce.Do(func() { handleErr = fmt.Errorf("%v", info) })
 					}
+				}()
+
+				visibilityOverride := new(int64)
+				msgCtx := context.WithValue(ctx, queueNameContextKey, queueName)
+				msgCtx = context.WithValue(msgCtx, messageAttributesContextKey, msg.MessageAttributes)
+				msgCtx = context.WithValue(msgCtx, attributesContextKey, msg.Attributes)
+				msgCtx = context.WithValue(msgCtx, visibilityOverrideContextKey, visibilityOverride)
+				if receiveCount, err := strconv.ParseInt(msg.Attributes["ApproximateReceiveCount"], 10, 64); err == nil {
+					msgCtx = context.WithValue(msgCtx, receiveCountContextKey, receiveCount)
+				}
 
-					wgMessage := &sync.WaitGroup{}
-					for _, msg := range res.ReceiveMessages {
-						wgMessage.Add(1)
-						go func(msg *aws.ReceiveMessage) {
-							defer func() {
-								if info := recover(); info != nil {
-									chFatal <- errors.New(fmt.Sprint(info))
-								}
-								wgMessage.Done()
-								<-t.semaphore
-							}()
-							t.semaphore <- 1
-							// execute handler
-							if err := handler.handler(msg.MessageID, msg.Body); err != nil {
-								if err := t.client.ReportFailureMessage(&aws.ReportFailureMessageArgs{
-									QueueID:       id,
-									ReceiptHandle: msg.ReceiptHandle,
-									WaitTime:      handler.option.WaitTime,
-								}); err != nil {
-									chFatal <- err
-									return
-								}
-							} else if err := t.client.ReportSuccessMessage(&aws.ReportSuccessMessageArgs{
-								QueueID:       id,
-								ReceiptHandle: msg.ReceiptHandle,
-							}); err != nil {
-								chFatal <- err
-								return
-							}
-						}(msg)
+				if err := t.compose(t.baseHandler(handler))(msgCtx, msg.MessageID, msg.Body); err != nil {
+					waitTime := handler.option.WaitTime
+					if *visibilityOverride > 0 {
+						waitTime = *visibilityOverride
 					}
-					wgMessage.Wait()
+					if err := buffer.addFailure(ctx, msg.ReceiptHandle, waitTime); err != nil {
+						errOnce.Do(func() { handleErr = err })
+					}
+				} else if err := buffer.addSuccess(ctx, msg.ReceiptHandle); err != nil {
+					errOnce.Do(func() { handleErr = err })
 				}
-			}(queueName, id, handler)
+			}(msg)
+		}
+		wgMessage.Wait()
+		if handleErr != nil {
+			return handleErr
+		}
+	}
+}
+
+func (t *subscriber) baseHandler(handler *handlerEntry) Handler {
+	return func(ctx context.Context, id string, message *string) error {
+		if handler.proto == nil {
+			return handler.handler(ctx, id, message)
 		}
-	}()
 
-	return <-chFatal
+		out := reflect.New(handler.proto)
+		attributes, _ := MessageAttributesFromContext(ctx)
+		if err := t.unmarshaler.Unmarshal(message, attributes, out.Interface()); err != nil {
+			return err
+		}
+		return handler.typedHandler(id, out.Elem().Interface())
+	}
 }
@@ -0,0 +1,170 @@
+package sub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wakuwaku3/example-pubsub.go/broker"
+	"github.com/wakuwaku3/example-pubsub.go/broker/memory"
+)
+
+func TestSubscribe_StopsOnContextCancel(t *testing.T) {
+	m := memory.NewBroker()
+	if _, err := m.GetQueueID(context.Background(), "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+
+	subscriber, err := NewSubscriber(m, &SubscriberOption{ConcurrencyMessageHandleLimit: 1})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	if err := subscriber.SetHandler("queue", func(ctx context.Context, id string, message *string) error {
+		return nil
+	}, &HandlerOption{WaitTime: 0}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- subscriber.Subscribe(ctx) }()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe did not return after ctx was canceled")
+	}
+}
+
+func TestSubscribe_RecoversFromHandlerPanic(t *testing.T) {
+	m := memory.NewBroker()
+	ctx := context.Background()
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+
+	subscriber, err := NewSubscriber(m, &SubscriberOption{ConcurrencyMessageHandleLimit: 1})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	if err := subscriber.SetHandler("queue", func(ctx context.Context, id string, message *string) error {
+		panic("boom")
+	}, &HandlerOption{WaitTime: 0}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	if err := m.SendMessage(ctx, &broker.SendMessageArgs{QueueID: "queue", Message: "msg"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- subscriber.Subscribe(ctx) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Subscribe to return the recovered panic as an error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe did not return after the handler panicked")
+	}
+}
+
+func TestSubscribe_RetriesAndOverridesVisibilityTimeout(t *testing.T) {
+	m := memory.NewBroker()
+	ctx := context.Background()
+	if _, err := m.GetTopicID(ctx, "topic", &broker.TopicConfigAttributes{}); err != nil {
+		t.Fatalf("GetTopicID: %v", err)
+	}
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+	if err := m.Subscribe("topic", "queue"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	subscriber, err := NewSubscriber(m, &SubscriberOption{
+		ConcurrencyMessageHandleLimit: 1,
+		AckFlushInterval:              10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	// BaseVisibilityTimeout を 0 にして、失敗したメッセージが即座に再可視化されるようにする
+	subscriber.Use(NewRetryMiddleware(&RetryOption{BaseVisibilityTimeout: 0, MaxVisibilityTimeout: 1}))
+
+	var attempts int32
+	succeeded := make(chan struct{})
+	if err := subscriber.SetHandler("queue", func(ctx context.Context, id string, message *string) error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return errors.New("fail on first attempt")
+		}
+		close(succeeded)
+		return nil
+	}, &HandlerOption{WaitTime: 0}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go subscriber.Subscribe(subCtx)
+
+	if err := m.Publish(ctx, &broker.PublishArgs{TopicID: "topic", Message: `{"ok":true}`}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	select {
+	case <-succeeded:
+		if got := atomic.LoadInt32(&attempts); got != 2 {
+			t.Fatalf("expected exactly 2 attempts, got %d", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler never succeeded after retry")
+	}
+}
+
+func TestSubscribe_FlushesAckBufferOnTimerBelowThreshold(t *testing.T) {
+	m := memory.NewBroker()
+	ctx := context.Background()
+	if _, err := m.GetQueueID(ctx, "queue", &broker.QueueConfigAttributes{}); err != nil {
+		t.Fatalf("GetQueueID: %v", err)
+	}
+	spy := newSpyBroker(m)
+
+	subscriber, err := NewSubscriber(spy, &SubscriberOption{
+		ConcurrencyMessageHandleLimit: 1,
+		AckFlushInterval:              20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSubscriber: %v", err)
+	}
+	if err := subscriber.SetHandler("queue", func(ctx context.Context, id string, message *string) error {
+		return nil
+	}, &HandlerOption{WaitTime: 0}); err != nil {
+		t.Fatalf("SetHandler: %v", err)
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go subscriber.Subscribe(subCtx)
+
+	if err := spy.SendMessage(ctx, &broker.SendMessageArgs{QueueID: "queue", Message: "msg"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// 1 件しか処理していないので MaxBatchSize(10) 件に満たず、タイマーによるフラッシュだけが ack を送信するはず
+	deadline := time.Now().Add(2 * time.Second)
+	for spy.successBatchCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("ack was not flushed by the AckFlushInterval timer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
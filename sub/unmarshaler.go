@@ -0,0 +1,19 @@
+package sub
+
+import "encoding/json"
+
+// Unmarshaler は受信メッセージの本文と MessageAttributes を out にデコードします
+type Unmarshaler interface {
+	Unmarshal(body *string, attributes map[string]string, out interface{}) error
+}
+
+type jsonUnmarshaler struct{}
+
+// NewJSONUnmarshaler は本文を json.Unmarshal でデコードする Unmarshaler を生成します
+func NewJSONUnmarshaler() Unmarshaler {
+	return &jsonUnmarshaler{}
+}
+
+func (t *jsonUnmarshaler) Unmarshal(body *string, attributes map[string]string, out interface{}) error {
+	return json.Unmarshal([]byte(*body), out)
+}
@@ -0,0 +1,18 @@
+package sub
+
+import (
+	"github.com/hamba/avro"
+)
+
+type avroUnmarshaler struct {
+	schema avro.Schema
+}
+
+// NewAvroUnmarshaler は schema に基づいて本文を Avro バイナリからデコードする Unmarshaler を生成します
+func NewAvroUnmarshaler(schema avro.Schema) Unmarshaler {
+	return &avroUnmarshaler{schema}
+}
+
+func (t *avroUnmarshaler) Unmarshal(body *string, attributes map[string]string, out interface{}) error {
+	return avro.Unmarshal(t.schema, []byte(*body), out)
+}
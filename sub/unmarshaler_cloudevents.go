@@ -0,0 +1,20 @@
+package sub
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+type cloudEventsUnmarshaler struct{}
+
+// NewCloudEventsUnmarshaler は CloudEvents の structured JSON 形式の本文から Data を取り出してデコードする Unmarshaler を生成します
+func NewCloudEventsUnmarshaler() Unmarshaler {
+	return &cloudEventsUnmarshaler{}
+}
+
+func (t *cloudEventsUnmarshaler) Unmarshal(body *string, attributes map[string]string, out interface{}) error {
+	event := cloudevents.NewEvent()
+	if err := event.UnmarshalJSON([]byte(*body)); err != nil {
+		return err
+	}
+	return event.DataAs(out)
+}